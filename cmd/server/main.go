@@ -15,15 +15,24 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"PulseSend/internal/api"
+	"PulseSend/internal/attachment"
 	"PulseSend/internal/config"
 	"PulseSend/internal/db"
+	"PulseSend/internal/dispatcher"
 	"PulseSend/internal/email"
 	"PulseSend/internal/metrics"
 	"PulseSend/internal/models"
+	"PulseSend/internal/recovery"
+	"PulseSend/internal/retry"
+	"PulseSend/internal/scheduler"
 	"PulseSend/internal/worker"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
 
 	// ------------------------------------------------
 	// Logger
@@ -87,19 +96,106 @@ func main() {
 	}()
 
 	// ------------------------------------------------
-	// Job Channel (shared by API + workers)
+	// Recovery (jobs left over from a previous run)
+	// ------------------------------------------------
+	if err := recovery.Recover(ctx, store, cfg.InstanceID, logger); err != nil {
+		logger.Fatal("job recovery failed", zap.Error(err))
+	}
+
+	// ------------------------------------------------
+	// Dispatcher (claims jobs from the DB for workers)
+	// ------------------------------------------------
+	jobs := make(chan models.EmailJob, cfg.WorkerCount)
+
+	dispatch := dispatcher.New(store, logger, dispatcher.Options{
+		Owner:             cfg.InstanceID,
+		Batch:             cfg.DispatchBatch,
+		Lease:             cfg.JobLease,
+		PollInterval:      cfg.DispatchPollInterval,
+		HeartbeatInterval: cfg.HeartbeatInterval,
+		FairShare:         cfg.DispatchFairShare,
+	})
+
+	go dispatch.Run(ctx, jobs)
+
+	// ------------------------------------------------
+	// Scheduler (releases jobs whose send_at is due)
+	// ------------------------------------------------
+	sched := &scheduler.Scheduler{
+		Store:     store,
+		Log:       logger,
+		Interval:  cfg.SchedulerInterval,
+		OnRelease: dispatch.Notify,
+	}
+
+	go sched.Run(ctx)
+
+	// ------------------------------------------------
+	// Templates
+	// ------------------------------------------------
+	templates, err := email.LoadTemplates(cfg.TemplateDir)
+	if err != nil {
+		logger.Fatal("failed to load templates", zap.Error(err))
+	}
+	logger.Info("templates loaded", zap.Int("templates", templates.Len()))
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
+	go func() {
+		for range hupChan {
+			if err := templates.Reload(); err != nil {
+				logger.Error("template reload failed, keeping previous templates", zap.Error(err))
+				continue
+			}
+			logger.Info("templates reloaded", zap.Int("templates", templates.Len()))
+		}
+	}()
+
+	if cfg.TemplateReloadInterval > 0 {
+		go templates.Watch(ctx, cfg.TemplateReloadInterval, logger)
+	}
+
+	// ------------------------------------------------
+	// Attachments
 	// ------------------------------------------------
-	jobs := make(chan models.EmailJob, 100)
+	attachments := &attachment.Store{
+		Dir:          cfg.AttachmentDir,
+		MaxSize:      cfg.AttachmentMaxSize,
+		MaxFiles:     cfg.AttachmentMaxFiles,
+		AllowedTypes: cfg.AttachmentTypes,
+	}
 
 	// ------------------------------------------------
 	// Email Sender
 	// ------------------------------------------------
+	senders, err := email.ParseIdentities(cfg.SenderIdentities, cfg.SMTPFrom)
+	if err != nil {
+		logger.Fatal("invalid sender identities", zap.Error(err))
+	}
+
+	dkim, err := email.LoadDKIMKeys(cfg.DKIMKeys)
+	if err != nil {
+		logger.Fatal("failed to load DKIM keys", zap.Error(err))
+	}
+	for domain, signer := range dkim {
+		logger.Info("DKIM signing enabled", zap.String("domain", domain), zap.String("selector", signer.Selector))
+	}
+
 	sender := &email.Sender{
 		Host:     cfg.SMTPHost,
 		Port:     cfg.SMTPPort,
 		From:     cfg.SMTPFrom,
 		Username: cfg.SMTPUser,
 		Password: cfg.SMTPPassword,
+
+		Templates:   templates,
+		Attachments: attachments,
+		DKIM:        dkim,
+
+		IdleTimeout: cfg.SMTPIdleTimeout,
+		MaxMessages: cfg.SMTPMaxMessages,
+		Timeout:     cfg.SMTPTimeout,
 	}
 
 	// ------------------------------------------------
@@ -107,6 +203,16 @@ func main() {
 	// ------------------------------------------------
 	limiter := rate.NewLimiter(rate.Limit(cfg.RateLimit), cfg.RateLimit)
 
+	// ------------------------------------------------
+	// Retry Policy
+	// ------------------------------------------------
+	retryPolicy := retry.Policy{
+		MaxAttempts: cfg.RetryAttempts,
+		Base:        cfg.RetryBase,
+		Cap:         cfg.RetryCap,
+		Jitter:      cfg.RetryJitter,
+	}
+
 	// ------------------------------------------------
 	// Worker Pool
 	// ------------------------------------------------
@@ -121,22 +227,34 @@ func main() {
 		limiter,
 		store,  // pass DB to update status
 		logger,
-		cfg.RetryAttempts,
+		retryPolicy,
+		cfg.InstanceID,
+		cfg.JobLease,
 	)
 
 	// ------------------------------------------------
 	// HTTP API Server
 	// ------------------------------------------------
 	apiHandler := &api.Handler{
-		Store: store,
-		Jobs:  jobs,
-		Log:   logger,
+		Store:       store,
+		Log:         logger,
+		Senders:     senders,
+		Attachments: attachments,
+		Notify:      dispatch.Notify,
 	}
 
 	apiMux := http.NewServeMux()
 	apiMux.HandleFunc("/send", apiHandler.SendEmail)
 	apiMux.HandleFunc("/send-bulk", apiHandler.SendBulk)
 	apiMux.HandleFunc("/send-bulk/csv", apiHandler.SendBulkCSV)
+	apiMux.HandleFunc("GET /emails", apiHandler.ListEmails)
+	apiMux.HandleFunc("GET /emails/{id}", apiHandler.GetEmail)
+	apiMux.HandleFunc("PATCH /emails/{id}", apiHandler.UpdateEmail)
+	apiMux.HandleFunc("DELETE /emails/{id}", apiHandler.CancelEmail)
+	apiMux.HandleFunc("GET /emails/{id}/attempts", apiHandler.ListAttempts)
+	apiMux.HandleFunc("POST /emails/{id}/retry", apiHandler.RetryEmail)
+	apiMux.HandleFunc("GET /dead-letters", apiHandler.ListDeadLetters)
+	apiMux.HandleFunc("POST /dead-letters/retry", apiHandler.RetryDeadLetters)
 
 	apiServer := &http.Server{
 		Addr:    ":" + cfg.APIPort,
@@ -157,9 +275,7 @@ func main() {
 
 	logger.Info("shutting down services...")
 
-	// Stop accepting new jobs
-	close(jobs)
-
+	// The dispatcher closes the job channel once ctx is cancelled.
 	// Wait workers to finish
 	wg.Wait()
 
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"PulseSend/internal/config"
+	"PulseSend/internal/db"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and when they were applied`
+
+// runMigrate implements the "migrate" subcommand. It only needs
+// DATABASE_URL and exits the process when done.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to load config:", err)
+		os.Exit(1)
+	}
+
+	store, err := db.Open(cfg.DatabaseURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "database connection failed:", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		n, err := store.MigrateUp(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate up failed:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("applied %d migration(s)\n", n)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "down: n must be a positive integer")
+				os.Exit(2)
+			}
+		}
+		n, err := store.MigrateDown(ctx, steps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate down failed:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("rolled back %d migration(s)\n", n)
+
+	case "status":
+		states, err := store.MigrationStatus(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate status failed:", err)
+			os.Exit(1)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, st := range states {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", st.Version, st.Name, applied)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
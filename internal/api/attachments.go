@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"PulseSend/internal/attachment"
+	"PulseSend/internal/models"
+)
+
+// attachmentField is the multipart field carrying uploaded attachments; it
+// may be repeated.
+const attachmentField = "attachment"
+
+// maxAttachmentBytes bounds the request body space attachments may take,
+// allowing for base64 in JSON requests.
+func (h *Handler) maxAttachmentBytes() int64 {
+	return int64(h.Attachments.MaxFiles) * h.Attachments.MaxSize * 4 / 3
+}
+
+// storeAttachments moves the job's attachment contents into the
+// attachment store and replaces them with references. Identical files,
+// e.g. the same invoice template for every bulk recipient, are stored once.
+func (h *Handler) storeAttachments(job *models.EmailJob) error {
+	if len(job.Attachments) == 0 {
+		return nil
+	}
+	if len(job.Attachments) > h.Attachments.MaxFiles {
+		return fmt.Errorf("%w: too many attachments (max %d)", attachment.ErrInvalid, h.Attachments.MaxFiles)
+	}
+
+	refs := make([]models.Attachment, len(job.Attachments))
+	for i, a := range job.Attachments {
+		ref, err := h.Attachments.Put(a)
+		if err != nil {
+			return err
+		}
+		refs[i] = ref
+	}
+	job.Attachments = refs
+	return nil
+}
+
+// uploadedAttachments reads the files of a parsed multipart form.
+func (h *Handler) uploadedAttachments(form *multipart.Form) ([]models.Attachment, error) {
+	var out []models.Attachment
+	for _, fh := range form.File[attachmentField] {
+		if fh.Size > h.Attachments.MaxSize {
+			return nil, fmt.Errorf("%w: %s is larger than %d bytes", attachment.ErrTooLarge, fh.Filename, h.Attachments.MaxSize)
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(io.LimitReader(f, h.Attachments.MaxSize+1))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		// Clients label most uploads application/octet-stream, which says
+		// nothing; let the store work out the type instead.
+		ct := fh.Header.Get("Content-Type")
+		if strings.HasPrefix(ct, "application/octet-stream") {
+			ct = ""
+		}
+
+		out = append(out, models.Attachment{
+			Filename:    fh.Filename,
+			ContentType: ct,
+			Content:     content,
+		})
+	}
+	return out, nil
+}
+
+// writeAttachmentError answers a failed storeAttachments call.
+func (h *Handler) writeAttachmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, attachment.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, attachment.ErrTypeNotAllowed):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, attachment.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.Log.Error("failed to store attachment", zap.Error(err))
+		http.Error(w, "failed to store attachment", http.StatusInternalServerError)
+	}
+}
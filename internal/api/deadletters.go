@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"PulseSend/internal/db"
+	"PulseSend/internal/models"
+)
+
+// deadLetter is the operator's view of a failed job.
+type deadLetter struct {
+	ID        int64  `json:"id"`
+	To        string `json:"to"`
+	Subject   string `json:"subject"`
+	Template  string `json:"template"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error"`
+	// FailureClass is "permanent" when retrying cannot help, e.g. after
+	// a 550 user unknown.
+	FailureClass models.FailureClass `json:"failure_class,omitempty"`
+	Tags         []string            `json:"tags,omitempty"`
+	FailedAt     time.Time           `json:"failed_at"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+// ListDeadLetters lists failed jobs with their last error, newest first.
+//
+// GET /dead-letters?template=welcome.html&tag=newsletter&since=2024-01-01T00:00:00Z&limit=50&cursor=<next_cursor>
+//
+// since filters on the time the job failed. Paging works like GET /emails.
+func (h *Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := db.EmailFilter{
+		Statuses: []models.EmailStatus{models.StatusFailed},
+		Template: strings.TrimSpace(q.Get("template")),
+		Tag:      strings.TrimSpace(q.Get("tag")),
+	}
+
+	var err error
+	if filter.UpdatedAfter, err = parseTimeParam(q, "since"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s := strings.TrimSpace(q.Get("limit")); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > db.MaxListLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(db.MaxListLimit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	if s := strings.TrimSpace(q.Get("cursor")); s != "" {
+		id, err := decodeCursor(s)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.BeforeID = id
+	}
+
+	jobs, err := h.Store.ListEmails(r.Context(), filter)
+	if err != nil {
+		h.Log.Error("failed to list dead letters", zap.Error(err))
+		http.Error(w, "failed to list dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	letters := make([]deadLetter, len(jobs))
+	for i, job := range jobs {
+		letters[i] = deadLetter{
+			ID:           job.ID,
+			To:           job.To,
+			Subject:      job.Subject,
+			Template:     job.Template,
+			Attempts:     job.Retries,
+			LastError:    job.ErrorMsg,
+			FailureClass: job.FailureClass,
+			Tags:         job.Tags,
+			FailedAt:     job.UpdatedAt,
+			CreatedAt:    job.CreatedAt,
+		}
+	}
+
+	resp := map[string]interface{}{
+		"dead_letters": letters,
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = db.DefaultListLimit
+	}
+	if len(jobs) == limit {
+		resp["next_cursor"] = encodeCursor(jobs[len(jobs)-1].ID)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// RetryEmail puts a single failed job back in the queue.
+//
+// POST /emails/{id}/retry
+//
+// Responds 409 Conflict with the current record if the job has not failed.
+func (h *Handler) RetryEmail(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseEmailID(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.Store.RetryEmail(r.Context(), id)
+	if err == nil {
+		h.notify()
+	}
+	h.writeModified(w, id, job, err)
+}
+
+type retryDeadLettersRequest struct {
+	Template string    `json:"template"`
+	Since    time.Time `json:"since"`
+}
+
+// RetryDeadLetters requeues failed jobs in bulk, e.g. after an SMTP outage.
+//
+// POST /dead-letters/retry
+//
+//	{
+//	  "template": "welcome.html",       (optional, all templates if empty)
+//	  "since": "2024-01-01T00:00:00Z"   (required, failed at or after)
+//	}
+//
+// since is required so a stray request cannot resend every failure ever
+// recorded.
+func (h *Handler) RetryDeadLetters(w http.ResponseWriter, r *http.Request) {
+	var req retryDeadLettersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Since.IsZero() {
+		http.Error(w, "since is required", http.StatusBadRequest)
+		return
+	}
+
+	n, err := h.Store.RetryFailed(r.Context(), strings.TrimSpace(req.Template), req.Since)
+	if err != nil {
+		h.Log.Error("failed to requeue dead letters", zap.Error(err))
+		http.Error(w, "failed to requeue dead letters", http.StatusInternalServerError)
+		return
+	}
+	if n > 0 {
+		h.notify()
+	}
+
+	h.Log.Info("requeued dead letters",
+		zap.String("template", req.Template),
+		zap.Time("since", req.Since),
+		zap.Int64("count", n),
+	)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"requeued": n,
+	})
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"PulseSend/internal/db"
+	"PulseSend/internal/email"
+	"PulseSend/internal/models"
+)
+
+// GetEmail returns the full job record, so callers can poll delivery status.
+//
+// GET /emails/{id}[?redact=true]
+//
+// With redact=true every template data value is replaced with "[redacted]";
+// keys are kept so callers can still see which fields were supplied.
+func (h *Handler) GetEmail(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseEmailID(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.Store.GetEmail(r.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "email not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Log.Error("failed to load email", zap.Int64("job_id", id), zap.Error(err))
+		http.Error(w, "failed to load email", http.StatusInternalServerError)
+		return
+	}
+
+	if redact, _ := strconv.ParseBool(r.URL.Query().Get("redact")); redact {
+		redactData(job)
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// CancelEmail cancels a job that has not started yet. Workers that already
+// hold the job skip it.
+//
+// DELETE /emails/{id}
+//
+// Responds 409 Conflict with the current record if the job has already
+// started or finished.
+func (h *Handler) CancelEmail(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseEmailID(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := h.Store.CancelEmail(r.Context(), id)
+	h.writeModified(w, id, job, err)
+}
+
+type updateEmailRequest struct {
+	Subject *string                `json:"subject"`
+	Data    map[string]interface{} `json:"data"`
+	SendAt  json.RawMessage        `json:"send_at"`
+}
+
+// UpdateEmail reschedules or edits a job that has not started yet.
+//
+// PATCH /emails/{id}
+//
+//	{
+//	  "send_at": "2025-01-01T09:00:00Z", (null sends as soon as possible)
+//	  "subject": "New subject",
+//	  "data": {"Name": "A"}               (replaces all template data)
+//	}
+//
+// Omitted fields are left unchanged. Responds 409 Conflict with the current
+// record if the job has already started or finished.
+func (h *Handler) UpdateEmail(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseEmailID(w, r)
+	if !ok {
+		return
+	}
+
+	var req updateEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	patch := db.EmailPatch{
+		Subject: req.Subject,
+		Data:    req.Data,
+	}
+
+	if patch.Subject != nil {
+		subject := strings.TrimSpace(*patch.Subject)
+		if subject == "" {
+			http.Error(w, "subject must not be empty", http.StatusBadRequest)
+			return
+		}
+		if err := email.ParseSubject(subject); err != nil {
+			http.Error(w, "invalid subject template: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		patch.Subject = &subject
+	}
+
+	if req.SendAt != nil {
+		patch.SetSendAt = true
+		if err := json.Unmarshal(req.SendAt, &patch.SendAt); err != nil {
+			http.Error(w, "send_at must be an RFC 3339 timestamp or null", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if patch.Subject == nil && patch.Data == nil && !patch.SetSendAt {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.Store.UpdateEmail(r.Context(), id, patch)
+	if err == nil {
+		h.notify()
+	}
+	h.writeModified(w, id, job, err)
+}
+
+func (h *Handler) writeModified(w http.ResponseWriter, id int64, job *models.EmailJob, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "email not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrNotModifiable):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error": err.Error(),
+			"email": job,
+		})
+	case err != nil:
+		h.Log.Error("failed to modify email", zap.Int64("job_id", id), zap.Error(err))
+		http.Error(w, "failed to modify email", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+func parseEmailID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid email id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// ListEmails searches jobs, newest first, with cursor-based pagination.
+//
+// GET /emails?status=failed,sent&to=a@example.com&template=email.html
+//
+//	&subject=reset&tag=newsletter&created_after=2024-01-01T00:00:00Z
+//	&created_before=2024-02-01T00:00:00Z&limit=50&cursor=<next_cursor>
+//
+// All parameters are optional. status accepts a comma-separated list,
+// subject matches substrings (case-insensitive), tag matches one of the
+// job's tags exactly, and the created_* bounds are RFC 3339 timestamps.
+// When more results may exist the response carries next_cursor; pass it
+// back as cursor to get the next page.
+func (h *Handler) ListEmails(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := db.EmailFilter{
+		To:       strings.TrimSpace(q.Get("to")),
+		Template: strings.TrimSpace(q.Get("template")),
+		Subject:  strings.TrimSpace(q.Get("subject")),
+		Tag:      strings.TrimSpace(q.Get("tag")),
+	}
+
+	if s := strings.TrimSpace(q.Get("status")); s != "" {
+		for _, part := range strings.Split(s, ",") {
+			st := models.EmailStatus(strings.TrimSpace(part))
+			if !st.Valid() {
+				http.Error(w, "invalid status: "+string(st), http.StatusBadRequest)
+				return
+			}
+			filter.Statuses = append(filter.Statuses, st)
+		}
+	}
+
+	var err error
+	if filter.CreatedAfter, err = parseTimeParam(q, "created_after"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.CreatedBefore, err = parseTimeParam(q, "created_before"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s := strings.TrimSpace(q.Get("limit")); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > db.MaxListLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(db.MaxListLimit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	if s := strings.TrimSpace(q.Get("cursor")); s != "" {
+		id, err := decodeCursor(s)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.BeforeID = id
+	}
+
+	jobs, err := h.Store.ListEmails(r.Context(), filter)
+	if err != nil {
+		h.Log.Error("failed to list emails", zap.Error(err))
+		http.Error(w, "failed to list emails", http.StatusInternalServerError)
+		return
+	}
+
+	if redact, _ := strconv.ParseBool(q.Get("redact")); redact {
+		for i := range jobs {
+			redactData(&jobs[i])
+		}
+	}
+
+	resp := map[string]interface{}{
+		"emails": jobs,
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = db.DefaultListLimit
+	}
+	if len(jobs) == limit {
+		resp["next_cursor"] = encodeCursor(jobs[len(jobs)-1].ID)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseTimeParam(q url.Values, name string) (time.Time, error) {
+	s := strings.TrimSpace(q.Get(name))
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New(name + " must be an RFC 3339 timestamp")
+	}
+	return t, nil
+}
+
+// Cursors are opaque to clients; today they wrap the last seen job id.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(s string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
+}
+
+// ListAttempts returns every delivery attempt of a job, oldest first, with
+// the SMTP host, reply and worker that made it.
+//
+// GET /emails/{id}/attempts
+func (h *Handler) ListAttempts(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseEmailID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if _, err := h.Store.GetEmail(ctx, id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "email not found", http.StatusNotFound)
+			return
+		}
+		h.Log.Error("failed to load email", zap.Int64("job_id", id), zap.Error(err))
+		http.Error(w, "failed to load email", http.StatusInternalServerError)
+		return
+	}
+
+	attempts, err := h.Store.ListAttempts(ctx, id)
+	if err != nil {
+		h.Log.Error("failed to list attempts", zap.Int64("job_id", id), zap.Error(err))
+		http.Error(w, "failed to list attempts", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"attempts": attempts,
+	})
+}
+
+func redactData(job *models.EmailJob) {
+	for k := range job.Data {
+		job.Data[k] = "[redacted]"
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
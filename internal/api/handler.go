@@ -1,71 +1,234 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
+	"PulseSend/internal/attachment"
 	"PulseSend/internal/csvparser"
 	"PulseSend/internal/db"
+	"PulseSend/internal/email"
 	"PulseSend/internal/models"
 )
 
 type Handler struct {
-	Store *db.Store
-	Jobs  chan<- models.EmailJob
+	Store db.Store
 	Log   *zap.Logger
+
+	// Senders lists the addresses jobs may use as from and reply_to.
+	Senders *email.Identities
+
+	// Attachments stores uploaded attachments and enforces their limits.
+	Attachments *attachment.Store
+
+	// Notify, if set, is called after jobs are inserted so the dispatcher
+	// can claim them right away instead of on its next poll.
+	Notify func()
+}
+
+func (h *Handler) notify() {
+	if h.Notify != nil {
+		h.Notify()
+	}
 }
 
+// IdempotencyHeader carries a client-chosen key that makes a send request
+// safe to retry. Replaying a key returns the original job instead of
+// queueing the email again.
+const IdempotencyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLen = 255
+
+// checkMessage validates the subject template, the custom headers and tags
+// and the sender fields of job, normalising them.
+func (h *Handler) checkMessage(job *models.EmailJob) error {
+	if err := email.ParseSubject(job.Subject); err != nil {
+		return fmt.Errorf("invalid subject template: %w", err)
+	}
+	if err := email.CheckHeaders(job); err != nil {
+		return err
+	}
+	if err := email.CheckTags(job); err != nil {
+		return err
+	}
+	return h.Senders.Check(job)
+}
+
+// SendEmail queues one email. The body is the job as JSON, attachments
+// included as base64 "content". Alternatively it is multipart/form-data
+// with the same JSON in the "email" field and files in "attachment"
+// fields.
 func (h *Handler) SendEmail(w http.ResponseWriter, r *http.Request) {
 	var job models.EmailJob
 
-	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20+h.maxAttachmentBytes())
+
+	if err := h.decodeSend(r, &job); err != nil {
+		writeDecodeError(w, err)
 		return
 	}
 
 	job.Status = models.StatusPending
 
-	ctx := r.Context()
+	if job.Priority == 0 {
+		job.Priority = models.PriorityNormal
+	}
+	if !job.Priority.Valid() {
+		http.Error(w, "priority must be 1 (low), 2 (normal) or 3 (high)", http.StatusBadRequest)
+		return
+	}
 
-	if err := h.Store.InsertEmail(ctx, &job); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := email.CheckRecipients(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.checkMessage(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.MultipartForm != nil {
+		uploads, err := h.uploadedAttachments(r.MultipartForm)
+		if err != nil {
+			h.writeAttachmentError(w, err)
+			return
+		}
+		job.Attachments = append(job.Attachments, uploads...)
+	}
+	if err := h.storeAttachments(&job); err != nil {
+		h.writeAttachmentError(w, err)
+		return
+	}
+
+	if key := strings.TrimSpace(r.Header.Get(IdempotencyHeader)); key != "" {
+		job.IdempotencyKey = key
+	}
+	if len(job.IdempotencyKey) > maxIdempotencyKeyLen {
+		http.Error(w, "idempotency key too long (max 255)", http.StatusBadRequest)
 		return
 	}
 
-	select {
-	case h.Jobs <- job:
-	case <-ctx.Done():
-		http.Error(w, "request cancelled", http.StatusRequestTimeout)
+	ctx := r.Context()
+
+	status := http.StatusAccepted
+	err := h.Store.InsertEmail(ctx, &job)
+	switch {
+	case errors.Is(err, db.ErrDuplicate):
+		status = http.StatusOK
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
+	default:
+		h.notify()
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id": job.ID,
+		"id":     job.ID,
+		"status": job.Status,
 	})
 }
 
+// writeDecodeError answers a request body that could not be read: 413 if
+// it is over the endpoint's size limit, 400 otherwise.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// decodeSend reads a /send request body into job.
+func (h *Handler) decodeSend(r *http.Request, job *models.EmailJob) error {
+	ct := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "multipart/form-data") {
+		return json.NewDecoder(r.Body).Decode(job)
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(r.FormValue("email")), job); err != nil {
+		return fmt.Errorf("field email: %w", err)
+	}
+	return nil
+}
+
+// recipientKey derives the idempotency key for one recipient of a bulk
+// request. An explicit per-recipient key wins; otherwise the request-level
+// header is combined with the address, so replaying the whole request is
+// safe while different recipients still get distinct jobs.
+func recipientKey(r *http.Request, explicit, to string) string {
+	if key := strings.TrimSpace(explicit); key != "" {
+		return key
+	}
+	if key := strings.TrimSpace(r.Header.Get(IdempotencyHeader)); key != "" {
+		return key + ":" + strings.ToLower(to)
+	}
+	return ""
+}
+
+// insertBulk stores one job of a bulk request and reports the outcome.
+func (h *Handler) insertBulk(ctx context.Context, job *models.EmailJob) bulkSendResult {
+	if len(job.IdempotencyKey) > maxIdempotencyKeyLen {
+		return bulkSendResult{To: job.To, Error: "idempotency key too long (max 255)"}
+	}
+	if err := email.CheckRecipients(job); err != nil {
+		return bulkSendResult{To: job.To, Error: err.Error()}
+	}
+
+	err := h.Store.InsertEmail(ctx, job)
+	switch {
+	case errors.Is(err, db.ErrDuplicate):
+		return bulkSendResult{To: job.To, ID: job.ID, Duplicate: true}
+	case err != nil:
+		return bulkSendResult{To: job.To, Error: err.Error()}
+	default:
+		return bulkSendResult{To: job.To, ID: job.ID}
+	}
+}
+
 type bulkRecipient struct {
-	To   string                 `json:"to"`
-	Data map[string]interface{} `json:"data"`
+	To             string                 `json:"to"`
+	Cc             []string               `json:"cc,omitempty"`
+	Bcc            []string               `json:"bcc,omitempty"`
+	Data           map[string]interface{} `json:"data"`
+	IdempotencyKey string                 `json:"idempotency_key,omitempty"`
 }
 
 type bulkSendRequest struct {
 	Subject    string          `json:"subject"`
 	Template   string          `json:"template"`
+	Priority   models.Priority `json:"priority,omitempty"`
+	SendAt     *time.Time      `json:"send_at,omitempty"`
+	From       string          `json:"from,omitempty"`
+	FromName   string          `json:"from_name,omitempty"`
+	ReplyTo    string          `json:"reply_to,omitempty"`
 	Recipients []bulkRecipient `json:"recipients"`
+
+	// Headers and Tags apply to every recipient.
+	Headers map[string]string `json:"headers,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+
+	// Attachments go to every recipient and are stored once.
+	Attachments []models.Attachment `json:"attachments,omitempty"`
 }
 
 type bulkSendResult struct {
-	To    string `json:"to"`
-	ID    int64  `json:"id,omitempty"`
-	Error string `json:"error,omitempty"`
+	To        string `json:"to"`
+	ID        int64  `json:"id,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Error     string `json:"error,omitempty"`
 }
 
 // SendBulk accepts JSON with a list of recipients and queues emails.
@@ -74,15 +237,25 @@ type bulkSendResult struct {
 // {
 //   "subject": "Hello",
 //   "template": "email.html",
+//   "priority": 1, (optional, default 1 = low)
+//   "send_at": "2025-01-01T09:00:00Z", (optional)
+//   "from": "news@example.com", "from_name": "Example News", (optional)
+//   "reply_to": "support@example.com", (optional)
+//   "headers": {"X-Campaign-ID": "spring-sale"}, "tags": ["newsletter"], (optional)
+//   "attachments": [{"filename": "terms.pdf", "content": "<base64>"}], (optional)
 //   "recipients": [
 //     {"to": "a@example.com", "data": {"Name":"A"}},
-//     {"to": "b@example.com", "data": {"Name":"B"}}
+//     {"to": "B <b@example.com>", "cc": ["manager@example.com"], "data": {"Name":"B"}}
 //   ]
 // }
 func (h *Handler) SendBulk(w http.ResponseWriter, r *http.Request) {
 	var req bulkSendRequest
+
+	// Limit request body size (recipient list plus base64 attachments).
+	r.Body = http.MaxBytesReader(w, r.Body, 5<<20+h.maxAttachmentBytes())
+
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeDecodeError(w, err)
 		return
 	}
 
@@ -96,11 +269,42 @@ func (h *Handler) SendBulk(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "recipients is required", http.StatusBadRequest)
 		return
 	}
+	if req.Priority == 0 {
+		req.Priority = models.PriorityLow
+	}
+	if !req.Priority.Valid() {
+		http.Error(w, "priority must be 1 (low), 2 (normal) or 3 (high)", http.StatusBadRequest)
+		return
+	}
 	if len(req.Recipients) > 1000 {
 		http.Error(w, "too many recipients (max 1000)", http.StatusBadRequest)
 		return
 	}
 
+	// Everything but the recipient is shared, so check it once.
+	base := models.EmailJob{
+		Subject:  req.Subject,
+		Template: req.Template,
+		Priority: req.Priority,
+		SendAt:   req.SendAt,
+		From:     req.From,
+		FromName: req.FromName,
+		ReplyTo:  req.ReplyTo,
+		Headers:  req.Headers,
+		Tags:     req.Tags,
+		Status:   models.StatusPending,
+
+		Attachments: req.Attachments,
+	}
+	if err := h.checkMessage(&base); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.storeAttachments(&base); err != nil {
+		h.writeAttachmentError(w, err)
+		return
+	}
+
 	ctx := r.Context()
 	results := make([]bulkSendResult, 0, len(req.Recipients))
 
@@ -114,28 +318,18 @@ func (h *Handler) SendBulk(w http.ResponseWriter, r *http.Request) {
 			rcpt.Data = map[string]interface{}{}
 		}
 
-		job := models.EmailJob{
-			To:       to,
-			Subject:  req.Subject,
-			Template: req.Template,
-			Data:     rcpt.Data,
-			Status:   models.StatusPending,
-		}
+		job := base
+		job.To = to
+		job.Cc = rcpt.Cc
+		job.Bcc = rcpt.Bcc
+		job.Data = rcpt.Data
+		job.IdempotencyKey = recipientKey(r, rcpt.IdempotencyKey, to)
 
-		if err := h.Store.InsertEmail(ctx, &job); err != nil {
-			results = append(results, bulkSendResult{To: to, Error: err.Error()})
-			continue
-		}
-
-		select {
-		case h.Jobs <- job:
-			results = append(results, bulkSendResult{To: to, ID: job.ID})
-		case <-ctx.Done():
-			results = append(results, bulkSendResult{To: to, ID: job.ID, Error: "request cancelled"})
-			// keep going to return what we have
-		}
+		results = append(results, h.insertBulk(ctx, &job))
 	}
 
+	h.notify()
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -149,14 +343,20 @@ func (h *Handler) SendBulk(w http.ResponseWriter, r *http.Request) {
 // - file: <csv file>
 // - subject: <email subject>
 // - template: <template filename, e.g. email.html>
+// - priority (optional): <1 low (default), 2 normal, 3 high>
+// - send_at (optional): <RFC 3339 time to send at>
+// - from, from_name, reply_to (optional): <sender identity, see SendBulk>
+// - header (optional, repeatable): <"Name: value" custom header>
+// - tags (optional): <comma-separated tags>
+// - attachment (optional, repeatable): <file sent to every recipient>
 func (h *Handler) SendBulkCSV(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// Limit request body size (CSV uploads).
-	r.Body = http.MaxBytesReader(w, r.Body, 5<<20) // 5MB
+	// Limit request body size (CSV uploads plus attachments).
+	r.Body = http.MaxBytesReader(w, r.Body, 5<<20+h.maxAttachmentBytes()) // 5MB
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeDecodeError(w, err)
 		return
 	}
 
@@ -167,6 +367,60 @@ func (h *Handler) SendBulkCSV(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	priority := models.PriorityLow
+	if s := strings.TrimSpace(r.FormValue("priority")); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || !models.Priority(n).Valid() {
+			http.Error(w, "priority must be 1 (low), 2 (normal) or 3 (high)", http.StatusBadRequest)
+			return
+		}
+		priority = models.Priority(n)
+	}
+
+	var sendAt *time.Time
+	if s := strings.TrimSpace(r.FormValue("send_at")); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			http.Error(w, "send_at must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		sendAt = &t
+	}
+
+	headers, err := formHeaders(r.MultipartForm.Value["header"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	base := models.EmailJob{
+		Subject:  subject,
+		Template: template,
+		Priority: priority,
+		SendAt:   sendAt,
+		From:     r.FormValue("from"),
+		FromName: r.FormValue("from_name"),
+		ReplyTo:  r.FormValue("reply_to"),
+		Headers:  headers,
+		Tags:     formTags(r.FormValue("tags")),
+		Status:   models.StatusPending,
+	}
+	if err := h.checkMessage(&base); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	uploads, err := h.uploadedAttachments(r.MultipartForm)
+	if err != nil {
+		h.writeAttachmentError(w, err)
+		return
+	}
+	base.Attachments = uploads
+	if err := h.storeAttachments(&base); err != nil {
+		h.writeAttachmentError(w, err)
+		return
+	}
+
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, "missing form file field 'file'", http.StatusBadRequest)
@@ -190,27 +444,16 @@ func (h *Handler) SendBulkCSV(w http.ResponseWriter, r *http.Request) {
 
 	results := make([]bulkSendResult, 0, len(records))
 	for _, rec := range records {
-		job := models.EmailJob{
-			To:       rec.To,
-			Subject:  subject,
-			Template: template,
-			Data:     rec.Data,
-			Status:   models.StatusPending,
-		}
+		job := base
+		job.To = rec.To
+		job.Data = rec.Data
+		job.IdempotencyKey = recipientKey(r, "", rec.To)
 
-		if err := h.Store.InsertEmail(ctx, &job); err != nil {
-			results = append(results, bulkSendResult{To: rec.To, Error: err.Error()})
-			continue
-		}
-
-		select {
-		case h.Jobs <- job:
-			results = append(results, bulkSendResult{To: rec.To, ID: job.ID})
-		case <-ctx.Done():
-			results = append(results, bulkSendResult{To: rec.To, ID: job.ID, Error: "request cancelled"})
-		}
+		results = append(results, h.insertBulk(ctx, &job))
 	}
 
+	h.notify()
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -218,6 +461,33 @@ func (h *Handler) SendBulkCSV(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// formHeaders parses repeated "Name: value" form fields into a header map.
+func formHeaders(fields []string) (map[string]string, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	headers := make(map[string]string, len(fields))
+	for _, f := range fields {
+		name, value, ok := strings.Cut(f, ":")
+		if !ok {
+			return nil, fmt.Errorf("header %q must be \"Name: value\"", f)
+		}
+		headers[strings.TrimSpace(name)] = value
+	}
+	return headers, nil
+}
+
+// formTags splits a comma-separated tags field.
+func formTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 type csvRecipientRecord struct {
 	To   string
 	Data map[string]interface{}
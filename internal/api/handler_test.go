@@ -0,0 +1,52 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"PulseSend/internal/attachment"
+	"PulseSend/internal/db"
+)
+
+func TestOversizedBody(t *testing.T) {
+	h := &Handler{
+		Store:       db.NewMemory(),
+		Log:         zap.NewNop(),
+		Attachments: &attachment.Store{MaxSize: 1024, MaxFiles: 1},
+	}
+	padding := strings.Repeat("x", 6<<20)
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	if err := mw.WriteField("email", `{"to":"a@example.com","subject":"`+padding+`","template":"t.html"}`); err != nil {
+		t.Fatal(err)
+	}
+	mw.Close()
+
+	for _, tc := range []struct {
+		name        string
+		handler     http.HandlerFunc
+		contentType string
+		body        string
+		want        int
+	}{
+		{"send json", h.SendEmail, "application/json", `{"to":"a@example.com","subject":"` + padding + `"}`, http.StatusRequestEntityTooLarge},
+		{"send multipart", h.SendEmail, mw.FormDataContentType(), form.String(), http.StatusRequestEntityTooLarge},
+		{"send-bulk", h.SendBulk, "application/json", `{"subject":"` + padding + `"}`, http.StatusRequestEntityTooLarge},
+		{"send malformed", h.SendEmail, "application/json", `{"to":`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		rec := httptest.NewRecorder()
+		tc.handler(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d (%s), want %d", tc.name, rec.Code, strings.TrimSpace(rec.Body.String()), tc.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package attachment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"PulseSend/internal/models"
+)
+
+var (
+	// ErrInvalid is returned for an attachment without a name, content or
+	// a parseable content type.
+	ErrInvalid = errors.New("invalid attachment")
+
+	// ErrTooLarge is returned for a file above Store.MaxSize.
+	ErrTooLarge = errors.New("attachment too large")
+
+	// ErrTypeNotAllowed is returned for a content type that is not in
+	// Store.AllowedTypes.
+	ErrTypeNotAllowed = errors.New("attachment type not allowed")
+)
+
+// Store keeps attachment contents on disk under their SHA-256, so a file
+// sent to many recipients, or sent again, is stored once. Jobs only hold
+// the reference (models.Attachment). When several instances share a
+// database they must share Dir as well.
+type Store struct {
+	Dir string
+
+	// MaxSize is the largest file accepted, in bytes.
+	MaxSize int64
+	// MaxFiles is the most attachments one email may carry.
+	MaxFiles int
+	// AllowedTypes lists the accepted media types, e.g. "application/pdf".
+	AllowedTypes []string
+}
+
+// Put validates and stores one attachment. a.Content is consumed: the
+// returned reference has SHA256, Size and ContentType set and no content.
+func (s *Store) Put(a models.Attachment) (models.Attachment, error) {
+	name := cleanFilename(a.Filename)
+	if name == "" {
+		return a, fmt.Errorf("%w: filename is required", ErrInvalid)
+	}
+	if len(a.Content) == 0 {
+		return a, fmt.Errorf("%w: %s is empty", ErrInvalid, name)
+	}
+	if int64(len(a.Content)) > s.MaxSize {
+		return a, fmt.Errorf("%w: %s is larger than %d bytes", ErrTooLarge, name, s.MaxSize)
+	}
+
+	ct, err := s.contentType(name, a.ContentType, a.Content)
+	if err != nil {
+		return a, err
+	}
+
+	sum := sha256.Sum256(a.Content)
+	ref := models.Attachment{
+		Filename:    name,
+		ContentType: ct,
+		Size:        int64(len(a.Content)),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+
+	if err := s.write(ref.SHA256, a.Content); err != nil {
+		return a, err
+	}
+	return ref, nil
+}
+
+// Read returns the contents of a stored attachment.
+func (s *Store) Read(ref models.Attachment) ([]byte, error) {
+	p, err := s.path(ref.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// write stores data under sum unless it is already there. Files are
+// written to a temporary name first so a reader never sees half a file.
+func (s *Store) write(sum string, data []byte) error {
+	p, err := s.path(sum)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// path is where the file with the given SHA-256 lives, fanned out by its
+// first two hex digits to keep directories small.
+func (s *Store) path(sum string) (string, error) {
+	if len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid attachment hash %q", sum)
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", fmt.Errorf("invalid attachment hash %q", sum)
+	}
+	return filepath.Join(s.Dir, sum[:2], sum), nil
+}
+
+// contentType settles the media type of an attachment: the declared one,
+// else the one implied by the file extension, else sniffed from the
+// content. It must be allowed.
+func (s *Store) contentType(name, declared string, data []byte) (string, error) {
+	ct := declared
+	if ct == "" {
+		ct = mime.TypeByExtension(filepath.Ext(name))
+	}
+	if ct == "" {
+		ct = http.DetectContentType(data)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s has content type %q", ErrInvalid, name, ct)
+	}
+
+	for _, allowed := range s.AllowedTypes {
+		if strings.EqualFold(strings.TrimSpace(allowed), mediaType) {
+			return mediaType, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s is %s", ErrTypeNotAllowed, name, mediaType)
+}
+
+// cleanFilename keeps the base name and drops characters that have no
+// business in a MIME header.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+}
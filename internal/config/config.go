@@ -1,6 +1,13 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
 
 type Config struct {
 	// ----------------------------
@@ -12,12 +19,73 @@ type Config struct {
 	SMTPPassword string `envconfig:"SMTP_PASSWORD" default:""`
 	SMTPFrom     string `envconfig:"SMTP_FROM" default:"noreply@pulsesend.com"`
 
+	// SenderIdentities lists the addresses and "@domains" jobs may use as
+	// from or reply_to, comma-separated. SMTPFrom is always allowed.
+	SenderIdentities string `envconfig:"SENDER_IDENTITIES" default:""`
+
+	// DKIMKeys lists "domain:selector:keyfile" entries, comma-separated.
+	// Mail from a listed domain is DKIM-signed with the PEM private key in
+	// keyfile; mail from other domains is sent unsigned.
+	DKIMKeys string `envconfig:"DKIM_KEYS" default:""`
+
+	// Each worker reuses one SMTP connection until it has been idle for
+	// SMTPIdleTimeout or has sent SMTPMaxMessages emails (0 = no limit).
+	SMTPIdleTimeout time.Duration `envconfig:"SMTP_IDLE_TIMEOUT" default:"30s"`
+	SMTPMaxMessages int           `envconfig:"SMTP_MAX_MESSAGES" default:"100"`
+	// SMTPTimeout bounds connecting to the server and each email's
+	// exchange with it, so a stalled server cannot hold a worker.
+	SMTPTimeout time.Duration `envconfig:"SMTP_TIMEOUT" default:"1m"`
+
+	// ----------------------------
+	// Templates
+	// ----------------------------
+	// Templates are parsed once at startup and reloaded on SIGHUP or when
+	// a file changes, checked every TemplateReloadInterval (0 disables).
+	TemplateDir            string        `envconfig:"TEMPLATE_DIR" default:"templates"`
+	TemplateReloadInterval time.Duration `envconfig:"TEMPLATE_RELOAD_INTERVAL" default:"5s"`
+
+	// ----------------------------
+	// Attachments
+	// ----------------------------
+	// Attachments are stored once per content under AttachmentDir, which
+	// must be shared by all instances using the same database.
+	AttachmentDir      string   `envconfig:"ATTACHMENT_DIR" default:"attachments"`
+	AttachmentMaxSize  int64    `envconfig:"ATTACHMENT_MAX_SIZE" default:"10485760"`
+	AttachmentMaxFiles int      `envconfig:"ATTACHMENT_MAX_FILES" default:"10"`
+	AttachmentTypes    []string `envconfig:"ATTACHMENT_TYPES" default:"application/pdf,image/png,image/jpeg,image/gif,text/plain,text/csv,text/calendar"`
+
 	// ----------------------------
 	// Workers
 	// ----------------------------
-	WorkerCount   int `envconfig:"WORKER_COUNT" default:"5"`
-	RateLimit     int `envconfig:"RATE_LIMIT" default:"10"`
-	RetryAttempts int `envconfig:"RETRY_ATTEMPTS" default:"3"`
+	WorkerCount int `envconfig:"WORKER_COUNT" default:"5"`
+	RateLimit   int `envconfig:"RATE_LIMIT" default:"10"`
+
+	// ----------------------------
+	// Retries
+	// ----------------------------
+	// RetryAttempts is the total number of delivery attempts per job,
+	// including the first. Later attempts wait RetryBase, doubling up to
+	// RetryCap, randomised by ±RetryJitter.
+	RetryAttempts int           `envconfig:"RETRY_ATTEMPTS" default:"3"`
+	RetryBase     time.Duration `envconfig:"RETRY_BASE" default:"30s"`
+	RetryCap      time.Duration `envconfig:"RETRY_CAP" default:"1h"`
+	RetryJitter   float64       `envconfig:"RETRY_JITTER" default:"0.2"`
+
+	// ----------------------------
+	// Dispatcher
+	// ----------------------------
+	DispatchBatch        int           `envconfig:"DISPATCH_BATCH" default:"10"`
+	DispatchPollInterval time.Duration `envconfig:"DISPATCH_POLL_INTERVAL" default:"1s"`
+	DispatchFairShare    int           `envconfig:"DISPATCH_FAIR_SHARE" default:"10"`
+	JobLease             time.Duration `envconfig:"JOB_LEASE" default:"1m"`
+	HeartbeatInterval    time.Duration `envconfig:"HEARTBEAT_INTERVAL" default:"20s"`
+	SchedulerInterval    time.Duration `envconfig:"SCHEDULER_INTERVAL" default:"5s"`
+
+	// InstanceID identifies this replica in job leases. Defaults to the
+	// hostname, which survives restarts, so a restarted instance releases
+	// the leases of its previous run at once. Replicas sharing a host
+	// must each set their own.
+	InstanceID string `envconfig:"INSTANCE_ID"`
 
 	// ----------------------------
 	// HTTP API
@@ -37,6 +105,76 @@ type Config struct {
 
 func Load() (*Config, error) {
 	var cfg Config
-	err := envconfig.Process("", &cfg)
-	return &cfg, err
+	if err := envconfig.Process("", &cfg); err != nil {
+		return &cfg, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return &cfg, err
+	}
+
+	if cfg.InstanceID == "" {
+		cfg.InstanceID = defaultInstanceID()
+	}
+
+	return &cfg, nil
+}
+
+// validate rejects settings the service cannot run with, rather than
+// letting them panic a ticker or spin a loop later.
+func (c *Config) validate() error {
+	switch {
+	case c.WorkerCount < 1:
+		return errors.New("WORKER_COUNT must be at least 1")
+	case c.RateLimit < 1:
+		return errors.New("RATE_LIMIT must be at least 1")
+
+	case c.SMTPIdleTimeout < 0:
+		return errors.New("SMTP_IDLE_TIMEOUT must not be negative")
+	case c.SMTPMaxMessages < 0:
+		return errors.New("SMTP_MAX_MESSAGES must not be negative")
+	case c.SMTPTimeout <= 0:
+		return errors.New("SMTP_TIMEOUT must be positive")
+	case c.TemplateReloadInterval < 0:
+		return errors.New("TEMPLATE_RELOAD_INTERVAL must not be negative")
+	case c.AttachmentMaxSize < 1:
+		return errors.New("ATTACHMENT_MAX_SIZE must be positive")
+	case c.AttachmentMaxFiles < 0:
+		return errors.New("ATTACHMENT_MAX_FILES must not be negative")
+
+	case c.RetryAttempts < 1:
+		return errors.New("RETRY_ATTEMPTS must be at least 1")
+	case c.RetryBase <= 0:
+		return errors.New("RETRY_BASE must be positive")
+	case c.RetryCap < c.RetryBase:
+		return errors.New("RETRY_CAP must not be less than RETRY_BASE")
+	case c.RetryJitter < 0 || c.RetryJitter > 1:
+		return errors.New("RETRY_JITTER must be between 0 and 1")
+
+	case c.DispatchBatch < 1:
+		return errors.New("DISPATCH_BATCH must be at least 1")
+	case c.DispatchPollInterval <= 0:
+		return errors.New("DISPATCH_POLL_INTERVAL must be positive")
+	case c.DispatchFairShare < 0:
+		return errors.New("DISPATCH_FAIR_SHARE must not be negative")
+	case c.SchedulerInterval <= 0:
+		return errors.New("SCHEDULER_INTERVAL must be positive")
+	case c.JobLease <= 0:
+		return errors.New("JOB_LEASE must be positive")
+	case c.HeartbeatInterval <= 0:
+		return errors.New("HEARTBEAT_INTERVAL must be positive")
+	case c.HeartbeatInterval >= c.JobLease:
+		// Leases would expire between renewals and jobs being sent could
+		// be claimed by another instance.
+		return fmt.Errorf("HEARTBEAT_INTERVAL (%s) must be shorter than JOB_LEASE (%s)", c.HeartbeatInterval, c.JobLease)
+	}
+	return nil
+}
+
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "pulsesend"
+	}
+	return host
 }
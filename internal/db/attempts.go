@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"PulseSend/internal/models"
+)
+
+// RecordAttempt stores a delivery attempt and sets its ID and Attempt
+// number, which counts attempts per job starting at 1.
+func (s *SQLStore) RecordAttempt(ctx context.Context, a *models.EmailAttempt) error {
+	var (
+		code sql.NullInt64
+		text sql.NullString
+		msg  sql.NullString
+	)
+	if a.ResponseCode != 0 {
+		code = sql.NullInt64{Int64: int64(a.ResponseCode), Valid: true}
+	}
+	if a.ResponseText != "" {
+		text = sql.NullString{String: a.ResponseText, Valid: true}
+	}
+	if a.Error != "" {
+		msg = sql.NullString{String: a.Error, Valid: true}
+	}
+
+	return s.DB.QueryRowContext(
+		ctx,
+		s.q(`INSERT INTO email_attempts
+		 (job_id, attempt, worker_id, smtp_host, started_at, finished_at,
+		  success, response_code, response_text, error)
+		 VALUES (?,
+		         (SELECT COALESCE(MAX(attempt), 0) + 1 FROM email_attempts WHERE job_id = ?),
+		         ?,?,?,?,?,?,?,?)
+		 RETURNING id, attempt`),
+		a.JobID,
+		a.JobID,
+		a.WorkerID,
+		a.SMTPHost,
+		a.StartedAt.UTC(),
+		a.FinishedAt.UTC(),
+		a.Success,
+		code,
+		text,
+		msg,
+	).Scan(&a.ID, &a.Attempt)
+}
+
+// ListAttempts returns all attempts of a job in the order they were made.
+func (s *SQLStore) ListAttempts(ctx context.Context, jobID int64) ([]models.EmailAttempt, error) {
+	rows, err := s.DB.QueryContext(
+		ctx,
+		s.q(`SELECT id, job_id, attempt, worker_id, smtp_host, started_at, finished_at,
+		        success, COALESCE(response_code, 0), COALESCE(response_text, ''),
+		        COALESCE(error, '')
+		 FROM email_attempts
+		 WHERE job_id = ?
+		 ORDER BY attempt`),
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := make([]models.EmailAttempt, 0)
+	for rows.Next() {
+		var a models.EmailAttempt
+		if err := rows.Scan(
+			&a.ID,
+			&a.JobID,
+			&a.Attempt,
+			&a.WorkerID,
+			&a.SMTPHost,
+			&a.StartedAt,
+			&a.FinishedAt,
+			&a.Success,
+			&a.ResponseCode,
+			&a.ResponseText,
+			&a.Error,
+		); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+func (m *MemoryStore) RecordAttempt(ctx context.Context, a *models.EmailAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextAttemptID++
+	a.ID = m.nextAttemptID
+	a.Attempt = len(m.attempts[a.JobID]) + 1
+
+	m.attempts[a.JobID] = append(m.attempts[a.JobID], *a)
+	return nil
+}
+
+func (m *MemoryStore) ListAttempts(ctx context.Context, jobID int64) ([]models.EmailAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.EmailAttempt{}, m.attempts[jobID]...), nil
+}
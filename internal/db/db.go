@@ -2,120 +2,164 @@ package db
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
 
 	"PulseSend/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when a job does not exist.
+	ErrNotFound = errors.New("email job not found")
+
+	// ErrNotClaimed is returned when a job can no longer be started
+	// because it was already picked up (or finished) by someone else.
+	ErrNotClaimed = errors.New("job is no longer claimable")
 
-	_ "github.com/mattn/go-sqlite3"
+	// ErrDuplicate is returned by InsertEmail when a job with the same
+	// idempotency key already exists. The job argument is overwritten
+	// with the existing record.
+	ErrDuplicate = errors.New("duplicate idempotency key")
+
+	// ErrNotModifiable is returned when cancelling or editing a job that
+	// has already started, finished or been cancelled.
+	ErrNotModifiable = errors.New("email job can no longer be modified")
 )
 
-type Store struct {
-	DB *sql.DB
-}
+// ClaimOrder decides which pending jobs ClaimJobs takes first.
+type ClaimOrder int
 
-func New(conn string) (*Store, error) {
-	// For SQLite, conn is typically a file path, e.g. "./pulsesend.db"
-	db, err := sql.Open("sqlite3", conn)
-	if err != nil {
-		return nil, err
-	}
+const (
+	// ClaimByPriority takes the highest priority first and the oldest
+	// job first within a priority.
+	ClaimByPriority ClaimOrder = iota
+	// ClaimOldestFirst ignores priority. The dispatcher reserves part of
+	// each batch for it so low-priority jobs cannot starve.
+	ClaimOldestFirst
+)
 
-	// SQLite is file-based; keep connections small/simple.
-	db.SetMaxOpenConns(1)
-
-	// Ensure schema exists.
-	schema := `
-	CREATE TABLE IF NOT EXISTS email_jobs (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		to_email   TEXT NOT NULL,
-		subject    TEXT NOT NULL,
-		template   TEXT NOT NULL,
-		data       TEXT NOT NULL,
-		status     TEXT NOT NULL,
-		retries    INTEGER NOT NULL DEFAULT 0,
-		error_msg  TEXT,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := db.Exec(schema); err != nil {
-		_ = db.Close()
-		return nil, err
-	}
+// EmailPatch describes changes to a job that has not started yet. Nil
+// fields are left unchanged.
+type EmailPatch struct {
+	Subject *string
+	Data    map[string]interface{}
 
-	return &Store{DB: db}, nil
+	// SetSendAt replaces send_at with SendAt; a nil SendAt clears it so
+	// the job is sent as soon as possible.
+	SetSendAt bool
+	SendAt    *time.Time
 }
 
-func (s *Store) Close() {
-	if s.DB != nil {
-		_ = s.DB.Close()
-	}
+// Store is the persistence layer for email jobs. The API inserts and
+// queries jobs, the dispatcher claims them and workers record the outcome.
+type Store interface {
+	// InsertEmail stores a new job and sets job.ID and job.Status: jobs
+	// with a future SendAt are scheduled, all others pending. If
+	// job.IdempotencyKey was used before, nothing is stored, job is
+	// replaced by the original and ErrDuplicate is returned.
+	InsertEmail(ctx context.Context, job *models.EmailJob) error
+	// GetEmail returns a single job, or ErrNotFound.
+	GetEmail(ctx context.Context, id int64) (*models.EmailJob, error)
+	// ListEmails returns jobs matching f, newest first.
+	ListEmails(ctx context.Context, f EmailFilter) ([]models.EmailJob, error)
+
+	// CancelEmail cancels a scheduled or pending job and returns it. It
+	// returns ErrNotModifiable once the job has started.
+	CancelEmail(ctx context.Context, id int64) (*models.EmailJob, error)
+	// UpdateEmail applies p to a scheduled or pending job and returns it.
+	// It returns ErrNotModifiable once the job has started.
+	UpdateEmail(ctx context.Context, id int64, p EmailPatch) (*models.EmailJob, error)
+
+	// RetryEmail moves a failed job back to pending with a fresh retry
+	// budget and returns it. It returns ErrNotModifiable if the job has not
+	// failed.
+	RetryEmail(ctx context.Context, id int64) (*models.EmailJob, error)
+	// RetryFailed moves every failed job matching template (all
+	// templates if empty) that failed at or after since back to pending,
+	// and returns how many were requeued.
+	RetryFailed(ctx context.Context, template string, since time.Time) (int64, error)
+
+	// UpdateStatus sets the job status and releases its lease.
+	UpdateStatus(ctx context.Context, id int64, status models.EmailStatus) error
+	// UpdateFailure marks the job failed, counts the attempt and records
+	// the error and its class.
+	UpdateFailure(ctx context.Context, id int64, errorMsg string, class models.FailureClass) error
+	// ScheduleRetry returns a job to pending after a transient failure,
+	// counts the attempt and records the error. The job is not claimed
+	// again before nextAt.
+	ScheduleRetry(ctx context.Context, id int64, errorMsg string, nextAt time.Time) error
+
+	// RecordAttempt stores one delivery attempt and numbers it.
+	RecordAttempt(ctx context.Context, a *models.EmailAttempt) error
+	// ListAttempts returns a job's attempts, oldest first.
+	ListAttempts(ctx context.Context, jobID int64) ([]models.EmailAttempt, error)
+
+	// ReleaseDue moves scheduled jobs that are due by now to pending.
+	ReleaseDue(ctx context.Context, now time.Time) (int64, error)
+	// ClaimJobs leases up to limit pending jobs to owner, in the given
+	// order.
+	ClaimJobs(ctx context.Context, owner string, limit int, lease time.Duration, order ClaimOrder) ([]models.EmailJob, error)
+	// StartJob moves a job claimed by owner to processing, or returns
+	// ErrNotClaimed.
+	StartJob(ctx context.Context, id int64, owner string, lease time.Duration) error
+	// Heartbeat renews every live lease held by owner.
+	Heartbeat(ctx context.Context, owner string, lease time.Duration) (int64, error)
+	// ReclaimExpired returns processing jobs with expired leases to pending.
+	ReclaimExpired(ctx context.Context) (int64, error)
+	// ResetStale releases all leases held by owner at startup.
+	ResetStale(ctx context.Context, owner string) (int64, error)
+
+	Close()
 }
 
-func (s *Store) InsertEmail(ctx context.Context, job *models.EmailJob) error {
-	dataJSON, err := json.Marshal(job.Data)
-	if err != nil {
-		return err
+// New opens the store described by conn and brings its schema up to date:
+//
+//   - postgres:// or postgresql:// URLs select PostgreSQL;
+//   - memory:// selects a non-persistent in-memory store, for tests and
+//     throwaway dev runs;
+//   - anything else is treated as a SQLite file path, e.g. "./pulsesend.db".
+func New(conn string) (Store, error) {
+	if strings.HasPrefix(conn, "memory://") {
+		return NewMemory(), nil
 	}
 
-	res, err := s.DB.ExecContext(
-		ctx,
-		`INSERT INTO email_jobs 
-		 (to_email, subject, template, data, status, retries, created_at, updated_at)
-		 VALUES (?,?,?,?,?,0,CURRENT_TIMESTAMP,CURRENT_TIMESTAMP)`,
-		job.To,
-		job.Subject,
-		job.Template,
-		string(dataJSON),
-		models.StatusPending,
-	)
+	store, err := Open(conn)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		return err
+	if _, err := store.MigrateUp(context.Background()); err != nil {
+		store.Close()
+		return nil, err
 	}
+	return store, nil
+}
 
-	job.ID = id
-	return nil
+// Open connects to a SQLite or PostgreSQL database without touching its
+// schema. It is used by the migrate command; the server uses New.
+func Open(conn string) (*SQLStore, error) {
+	if strings.HasPrefix(conn, "postgres://") || strings.HasPrefix(conn, "postgresql://") {
+		return openPostgres(conn)
+	}
+	return openSQLite(conn)
 }
 
-func (s *Store) UpdateStatus(
-	ctx context.Context,
-	id int64,
-	status models.EmailStatus,
-) error {
-	_, err := s.DB.ExecContext(
-		ctx,
-		`UPDATE email_jobs
-		 SET status = ?,
-		     updated_at = CURRENT_TIMESTAMP
-		 WHERE id = ?`,
-		status,
-		id,
-	)
-	return err
+// sortClaimed puts claimed jobs into the order they should be sent in.
+func sortClaimed(jobs []models.EmailJob, order ClaimOrder) {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if order == ClaimByPriority && jobs[i].Priority != jobs[j].Priority {
+			return jobs[i].Priority > jobs[j].Priority
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
 }
 
-func (s *Store) UpdateFailure(
-	ctx context.Context,
-	id int64,
-	errorMsg string,
-) error {
-	_, err := s.DB.ExecContext(
-		ctx,
-		`UPDATE email_jobs
-		 SET status = ?,
-		     retries = retries + 1,
-		     error_msg = ?,
-		     updated_at = CURRENT_TIMESTAMP
-		 WHERE id = ?`,
-		models.StatusFailed,
-		errorMsg,
-		id,
-	)
-	return err
+// initialStatus is the status a new job is stored with.
+func initialStatus(job *models.EmailJob, now time.Time) models.EmailStatus {
+	if job.SendAt != nil && job.SendAt.After(now) {
+		return models.StatusScheduled
+	}
+	return models.StatusPending
 }
@@ -0,0 +1,433 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"PulseSend/internal/models"
+)
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is a Store that keeps jobs in process memory. Nothing
+// survives a restart, so it is only meant for tests and ephemeral dev runs.
+type MemoryStore struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]*memoryJob
+	keys   map[string]int64
+
+	nextAttemptID int64
+	attempts      map[int64][]models.EmailAttempt
+}
+
+type memoryJob struct {
+	job         models.EmailJob
+	leaseOwner  string
+	leaseUntil  time.Time
+	heartbeatAt time.Time
+}
+
+func NewMemory() *MemoryStore {
+	return &MemoryStore{
+		jobs: make(map[int64]*memoryJob),
+		keys: make(map[string]int64),
+
+		attempts: make(map[int64][]models.EmailAttempt),
+	}
+}
+
+func (m *MemoryStore) Close() {}
+
+func (m *MemoryStore) InsertEmail(ctx context.Context, job *models.EmailJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job.IdempotencyKey != "" {
+		if id, ok := m.keys[job.IdempotencyKey]; ok {
+			*job = copyJob(m.jobs[id].job)
+			return ErrDuplicate
+		}
+	}
+
+	m.nextID++
+	now := time.Now().UTC()
+
+	job.ID = m.nextID
+	job.Status = initialStatus(job, now)
+	if job.Priority == 0 {
+		job.Priority = models.PriorityNormal
+	}
+	job.Retries = 0
+	job.ErrorMsg = ""
+	job.FailureClass = ""
+	job.NextRetryAt = nil
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	m.jobs[job.ID] = &memoryJob{job: copyJob(*job)}
+	if job.IdempotencyKey != "" {
+		m.keys[job.IdempotencyKey] = job.ID
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetEmail(ctx context.Context, id int64) (*models.EmailJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	job := copyJob(r.job)
+	return &job, nil
+}
+
+func (m *MemoryStore) CancelEmail(ctx context.Context, id int64) (*models.EmailJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !r.modifiable() {
+		job := copyJob(r.job)
+		return &job, ErrNotModifiable
+	}
+
+	r.job.Status = models.StatusCancelled
+	r.release()
+	r.touch()
+
+	job := copyJob(r.job)
+	return &job, nil
+}
+
+func (m *MemoryStore) UpdateEmail(ctx context.Context, id int64, p EmailPatch) (*models.EmailJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !r.modifiable() {
+		job := copyJob(r.job)
+		return &job, ErrNotModifiable
+	}
+
+	if p.Subject != nil {
+		r.job.Subject = *p.Subject
+	}
+	if p.Data != nil {
+		r.job.Data = copyJob(models.EmailJob{Data: p.Data}).Data
+	}
+	if p.SetSendAt {
+		r.job.SendAt = nil
+		if p.SendAt != nil {
+			t := p.SendAt.UTC()
+			r.job.SendAt = &t
+		}
+		r.job.Status = initialStatus(&r.job, time.Now())
+	}
+	r.release()
+	r.touch()
+
+	job := copyJob(r.job)
+	return &job, nil
+}
+
+func (m *MemoryStore) RetryEmail(ctx context.Context, id int64) (*models.EmailJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if r.job.Status != models.StatusFailed {
+		job := copyJob(r.job)
+		return &job, ErrNotModifiable
+	}
+
+	r.job.Status = models.StatusPending
+	r.job.Retries = 0
+	r.job.NextRetryAt = nil
+	r.touch()
+
+	job := copyJob(r.job)
+	return &job, nil
+}
+
+func (m *MemoryStore) RetryFailed(ctx context.Context, template string, since time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := EmailFilter{
+		Statuses:     []models.EmailStatus{models.StatusFailed},
+		Template:     template,
+		UpdatedAfter: since,
+	}
+
+	var n int64
+	for _, r := range m.jobs {
+		if !f.matches(r.job) {
+			continue
+		}
+		r.job.Status = models.StatusPending
+		r.job.Retries = 0
+		r.job.NextRetryAt = nil
+		r.touch()
+		n++
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) UpdateStatus(ctx context.Context, id int64, status models.EmailStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.jobs[id]; ok {
+		r.job.Status = status
+		r.release()
+		r.touch()
+	}
+	return nil
+}
+
+func (m *MemoryStore) UpdateFailure(ctx context.Context, id int64, errorMsg string, class models.FailureClass) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.jobs[id]; ok {
+		r.job.Status = models.StatusFailed
+		r.job.Retries++
+		r.job.ErrorMsg = errorMsg
+		r.job.FailureClass = class
+		r.job.NextRetryAt = nil
+		r.release()
+		r.touch()
+	}
+	return nil
+}
+
+func (m *MemoryStore) ScheduleRetry(ctx context.Context, id int64, errorMsg string, nextAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.jobs[id]; ok {
+		t := nextAt.UTC()
+		r.job.Status = models.StatusPending
+		r.job.Retries++
+		r.job.ErrorMsg = errorMsg
+		r.job.FailureClass = models.FailureTransient
+		r.job.NextRetryAt = &t
+		r.release()
+		r.touch()
+	}
+	return nil
+}
+
+func (m *MemoryStore) ReleaseDue(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for _, r := range m.jobs {
+		if r.job.Status != models.StatusScheduled || r.job.SendAt == nil || r.job.SendAt.After(now) {
+			continue
+		}
+		r.job.Status = models.StatusPending
+		r.touch()
+		n++
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) ClaimJobs(ctx context.Context, owner string, limit int, lease time.Duration, order ClaimOrder) ([]models.EmailJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	candidates := m.sorted()
+	if order == ClaimByPriority {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].job.Priority > candidates[j].job.Priority
+		})
+	}
+
+	var claimed []models.EmailJob
+	for _, r := range candidates {
+		if len(claimed) >= limit {
+			break
+		}
+		if r.job.Status != models.StatusPending || r.leased(now) || r.waiting(now) {
+			continue
+		}
+
+		r.leaseOwner = owner
+		r.leaseUntil = now.Add(lease)
+		r.heartbeatAt = now
+		r.touch()
+
+		claimed = append(claimed, copyJob(r.job))
+	}
+	return claimed, nil
+}
+
+func (m *MemoryStore) StartJob(ctx context.Context, id int64, owner string, lease time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	r, ok := m.jobs[id]
+	if !ok || r.job.Status != models.StatusPending || r.leaseOwner != owner || !r.leased(now) {
+		return ErrNotClaimed
+	}
+
+	r.job.Status = models.StatusProcessing
+	r.leaseUntil = now.Add(lease)
+	r.heartbeatAt = now
+	r.touch()
+	return nil
+}
+
+func (m *MemoryStore) Heartbeat(ctx context.Context, owner string, lease time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	var n int64
+	for _, r := range m.jobs {
+		if r.leaseOwner != owner || !r.leased(now) || !r.unfinished() {
+			continue
+		}
+		r.leaseUntil = now.Add(lease)
+		r.heartbeatAt = now
+		n++
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) ReclaimExpired(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	var n int64
+	for _, r := range m.jobs {
+		if r.job.Status != models.StatusProcessing || r.leaseUntil.IsZero() || r.leased(now) {
+			continue
+		}
+		r.job.Status = models.StatusPending
+		r.release()
+		r.touch()
+		n++
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) ResetStale(ctx context.Context, owner string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for _, r := range m.jobs {
+		if !r.unfinished() {
+			continue
+		}
+		orphaned := r.job.Status == models.StatusProcessing && r.leaseUntil.IsZero()
+		if r.leaseOwner != owner && !orphaned {
+			continue
+		}
+		r.job.Status = models.StatusPending
+		r.release()
+		r.touch()
+		n++
+	}
+	return n, nil
+}
+
+// sorted returns all jobs ordered by id. Callers must hold m.mu.
+func (m *MemoryStore) sorted() []*memoryJob {
+	out := make([]*memoryJob, 0, len(m.jobs))
+	for _, r := range m.jobs {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].job.ID < out[j].job.ID })
+	return out
+}
+
+func (r *memoryJob) leased(now time.Time) bool {
+	return !r.leaseUntil.IsZero() && !r.leaseUntil.Before(now)
+}
+
+func (r *memoryJob) waiting(now time.Time) bool {
+	return r.job.NextRetryAt != nil && r.job.NextRetryAt.After(now)
+}
+
+func (r *memoryJob) unfinished() bool {
+	return r.job.Status == models.StatusPending || r.job.Status == models.StatusProcessing
+}
+
+func (r *memoryJob) modifiable() bool {
+	return r.job.Status == models.StatusScheduled || r.job.Status == models.StatusPending
+}
+
+func (r *memoryJob) release() {
+	r.leaseOwner = ""
+	r.leaseUntil = time.Time{}
+}
+
+func (r *memoryJob) touch() {
+	r.job.UpdatedAt = time.Now().UTC()
+}
+
+// copyJob returns job with its own copy of Data, Cc, Bcc, Attachments,
+// SendAt and NextRetryAt, so callers cannot mutate stored state.
+func copyJob(job models.EmailJob) models.EmailJob {
+	if job.SendAt != nil {
+		t := *job.SendAt
+		job.SendAt = &t
+	}
+	if job.NextRetryAt != nil {
+		t := *job.NextRetryAt
+		job.NextRetryAt = &t
+	}
+	if job.Attachments != nil {
+		job.Attachments = append([]models.Attachment(nil), job.Attachments...)
+	}
+	if job.Cc != nil {
+		job.Cc = append([]string(nil), job.Cc...)
+	}
+	if job.Bcc != nil {
+		job.Bcc = append([]string(nil), job.Bcc...)
+	}
+	if job.Tags != nil {
+		job.Tags = append([]string(nil), job.Tags...)
+	}
+	if job.Headers != nil {
+		headers := make(map[string]string, len(job.Headers))
+		for k, v := range job.Headers {
+			headers[k] = v
+		}
+		job.Headers = headers
+	}
+	if job.Data != nil {
+		data := make(map[string]interface{}, len(job.Data))
+		for k, v := range job.Data {
+			data[k] = v
+		}
+		job.Data = data
+	}
+	return job
+}
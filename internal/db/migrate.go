@@ -0,0 +1,296 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/<dialect>/ as numbered pairs:
+//
+//	0003_add_send_at.up.sql
+//	0003_add_send_at.down.sql
+//
+// Versions must be unique per dialect and are applied in order. Every
+// schema change ships as a new file; applied files are never edited.
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+// Migration is one numbered schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState reports whether a migration has been applied.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// postgresMigrationLock is the pg_advisory_lock key that serialises
+// migrations when several replicas start at once.
+const postgresMigrationLock = 7_343_011
+
+func (d dialect) migrationDir() string {
+	if d == dialectPostgres {
+		return "migrations/postgres"
+	}
+	return "migrations/sqlite"
+}
+
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := d.migrationDir()
+
+	entries, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description", name)
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: bad version: %w", name, err)
+		}
+
+		body, err := fs.ReadFile(migrationFS, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration version %d used by both %q and %q", version, m.Name, label)
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration and returns how many ran.
+func (s *SQLStore) MigrateUp(ctx context.Context) (int, error) {
+	var applied int
+	err := s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		if err := createMigrationTable(ctx, conn); err != nil {
+			return err
+		}
+		states, err := s.migrationStates(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, st := range states {
+			if st.AppliedAt != nil {
+				continue
+			}
+			if err := s.applyMigration(ctx, conn, st.Migration, true); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown rolls back the most recent steps migrations and returns how
+// many were rolled back.
+func (s *SQLStore) MigrateDown(ctx context.Context, steps int) (int, error) {
+	var reverted int
+	err := s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		if err := createMigrationTable(ctx, conn); err != nil {
+			return err
+		}
+		states, err := s.migrationStates(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(states) - 1; i >= 0 && reverted < steps; i-- {
+			st := states[i]
+			if st.AppliedAt == nil {
+				continue
+			}
+			if st.Down == "" {
+				return fmt.Errorf("migration %04d_%s cannot be rolled back: no down file", st.Version, st.Name)
+			}
+			if err := s.applyMigration(ctx, conn, st.Migration, false); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus lists all known migrations with their applied time. It
+// only reads: it neither creates schema_migrations, reporting every
+// migration as pending when the table is missing, nor waits for a
+// migration that is running.
+func (s *SQLStore) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return s.migrationStates(ctx, conn)
+}
+
+// withMigrationLock runs fn on a single connection, holding an advisory
+// lock on Postgres so concurrent starts do not race. SQLite already uses
+// a single connection.
+func (s *SQLStore) withMigrationLock(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if s.dialect == dialectPostgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, postgresMigrationLock); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, postgresMigrationLock)
+	}
+
+	return fn(conn)
+}
+
+func createMigrationTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	return err
+}
+
+// migrationTableExists reports whether schema_migrations exists, looking
+// it up in the search path on Postgres.
+func (s *SQLStore) migrationTableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	query := `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	if s.dialect == dialectPostgres {
+		query = `SELECT to_regclass('schema_migrations') IS NOT NULL`
+	}
+
+	var exists bool
+	err := conn.QueryRowContext(ctx, query).Scan(&exists)
+	return exists, err
+}
+
+func (s *SQLStore) migrationStates(ctx context.Context, conn *sql.Conn) ([]MigrationState, error) {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i].Migration = m
+	}
+
+	// Nothing has been applied to a database never migrated.
+	exists, err := s.migrationTableExists(ctx, conn)
+	if err != nil || !exists {
+		return states, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version int
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range states {
+		if at, ok := applied[states[i].Version]; ok {
+			states[i].AppliedAt = &at
+		}
+	}
+	return states, nil
+}
+
+func (s *SQLStore) applyMigration(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	body, record, args := m.Up, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, []any{m.Version, m.Name}
+	if !up {
+		body, record, args = m.Down, `DELETE FROM schema_migrations WHERE version = ?`, []any{m.Version}
+	}
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, s.q(record), args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS email_jobs (
+	id         BIGSERIAL PRIMARY KEY,
+	to_email   TEXT NOT NULL,
+	subject    TEXT NOT NULL,
+	template   TEXT NOT NULL,
+	data       JSONB NOT NULL,
+	status     TEXT NOT NULL,
+	retries    INTEGER NOT NULL DEFAULT 0,
+	error_msg  TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_email_jobs_status;
+
+ALTER TABLE email_jobs
+	DROP COLUMN IF EXISTS heartbeat_at,
+	DROP COLUMN IF EXISTS lease_until,
+	DROP COLUMN IF EXISTS lease_owner;
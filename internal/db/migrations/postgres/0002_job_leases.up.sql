@@ -0,0 +1,6 @@
+ALTER TABLE email_jobs
+	ADD COLUMN IF NOT EXISTS lease_owner  TEXT,
+	ADD COLUMN IF NOT EXISTS lease_until  TIMESTAMPTZ,
+	ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_email_jobs_status ON email_jobs (status, id);
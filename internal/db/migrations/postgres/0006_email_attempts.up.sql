@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS email_attempts (
+	id            BIGSERIAL PRIMARY KEY,
+	job_id        BIGINT NOT NULL REFERENCES email_jobs (id) ON DELETE CASCADE,
+	attempt       INTEGER NOT NULL,
+	worker_id     TEXT NOT NULL,
+	smtp_host     TEXT NOT NULL,
+	started_at    TIMESTAMPTZ NOT NULL,
+	finished_at   TIMESTAMPTZ NOT NULL,
+	success       BOOLEAN NOT NULL,
+	response_code INTEGER,
+	response_text TEXT,
+	error         TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_attempts_job ON email_attempts (job_id, attempt);
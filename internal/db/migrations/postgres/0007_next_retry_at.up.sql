@@ -0,0 +1 @@
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS next_retry_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS failure_class TEXT;
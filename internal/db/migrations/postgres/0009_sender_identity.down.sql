@@ -0,0 +1,3 @@
+ALTER TABLE email_jobs DROP COLUMN IF EXISTS reply_to;
+ALTER TABLE email_jobs DROP COLUMN IF EXISTS from_name;
+ALTER TABLE email_jobs DROP COLUMN IF EXISTS from_email;
@@ -0,0 +1,3 @@
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS from_email TEXT;
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS from_name TEXT;
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS reply_to TEXT;
@@ -0,0 +1 @@
+ALTER TABLE email_jobs DROP COLUMN IF EXISTS attachments;
@@ -0,0 +1,2 @@
+ALTER TABLE email_jobs DROP COLUMN IF EXISTS bcc;
+ALTER TABLE email_jobs DROP COLUMN IF EXISTS cc;
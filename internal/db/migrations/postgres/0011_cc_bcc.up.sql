@@ -0,0 +1,2 @@
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS cc TEXT;
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS bcc TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE email_jobs DROP COLUMN IF EXISTS tags;
+ALTER TABLE email_jobs DROP COLUMN IF EXISTS headers;
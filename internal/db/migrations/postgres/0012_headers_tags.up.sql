@@ -0,0 +1,2 @@
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS headers TEXT;
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS tags TEXT;
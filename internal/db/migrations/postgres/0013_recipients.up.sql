@@ -0,0 +1,4 @@
+ALTER TABLE email_jobs ADD COLUMN IF NOT EXISTS recipients TEXT;
+UPDATE email_jobs SET recipients = '["' || LOWER(TRIM(to_email)) || '"]'
+ WHERE recipients IS NULL AND cc IS NULL AND bcc IS NULL
+   AND to_email NOT LIKE '%,%' AND to_email NOT LIKE '%<%' AND to_email NOT LIKE '%"%';
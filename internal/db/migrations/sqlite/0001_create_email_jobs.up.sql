@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS email_jobs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	to_email   TEXT NOT NULL,
+	subject    TEXT NOT NULL,
+	template   TEXT NOT NULL,
+	data       TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	retries    INTEGER NOT NULL DEFAULT 0,
+	error_msg  TEXT,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_email_jobs_status;
+
+ALTER TABLE email_jobs DROP COLUMN heartbeat_at;
+ALTER TABLE email_jobs DROP COLUMN lease_until;
+ALTER TABLE email_jobs DROP COLUMN lease_owner;
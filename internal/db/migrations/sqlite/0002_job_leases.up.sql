@@ -0,0 +1,5 @@
+ALTER TABLE email_jobs ADD COLUMN lease_owner TEXT;
+ALTER TABLE email_jobs ADD COLUMN lease_until DATETIME;
+ALTER TABLE email_jobs ADD COLUMN heartbeat_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_email_jobs_status ON email_jobs (status, id);
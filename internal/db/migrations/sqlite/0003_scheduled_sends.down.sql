@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_email_jobs_send_at;
+
+ALTER TABLE email_jobs DROP COLUMN send_at;
@@ -0,0 +1,3 @@
+ALTER TABLE email_jobs ADD COLUMN send_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_email_jobs_send_at ON email_jobs (status, send_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_email_jobs_idempotency_key;
+
+ALTER TABLE email_jobs DROP COLUMN idempotency_key;
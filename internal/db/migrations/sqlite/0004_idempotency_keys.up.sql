@@ -0,0 +1,3 @@
+ALTER TABLE email_jobs ADD COLUMN idempotency_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_jobs_idempotency_key ON email_jobs (idempotency_key);
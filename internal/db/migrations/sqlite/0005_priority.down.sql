@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_email_jobs_priority;
+
+ALTER TABLE email_jobs DROP COLUMN priority;
@@ -0,0 +1,3 @@
+ALTER TABLE email_jobs ADD COLUMN priority INTEGER NOT NULL DEFAULT 2;
+
+CREATE INDEX IF NOT EXISTS idx_email_jobs_priority ON email_jobs (status, priority DESC, id);
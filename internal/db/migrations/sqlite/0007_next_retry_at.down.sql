@@ -0,0 +1 @@
+ALTER TABLE email_jobs DROP COLUMN next_retry_at;
@@ -0,0 +1 @@
+ALTER TABLE email_jobs ADD COLUMN next_retry_at DATETIME;
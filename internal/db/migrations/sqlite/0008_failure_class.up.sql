@@ -0,0 +1 @@
+ALTER TABLE email_jobs ADD COLUMN failure_class TEXT;
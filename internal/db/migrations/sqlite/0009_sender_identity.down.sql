@@ -0,0 +1,3 @@
+ALTER TABLE email_jobs DROP COLUMN reply_to;
+ALTER TABLE email_jobs DROP COLUMN from_name;
+ALTER TABLE email_jobs DROP COLUMN from_email;
@@ -0,0 +1,3 @@
+ALTER TABLE email_jobs ADD COLUMN from_email TEXT;
+ALTER TABLE email_jobs ADD COLUMN from_name TEXT;
+ALTER TABLE email_jobs ADD COLUMN reply_to TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE email_jobs DROP COLUMN bcc;
+ALTER TABLE email_jobs DROP COLUMN cc;
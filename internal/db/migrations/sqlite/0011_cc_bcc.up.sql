@@ -0,0 +1,2 @@
+ALTER TABLE email_jobs ADD COLUMN cc TEXT;
+ALTER TABLE email_jobs ADD COLUMN bcc TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE email_jobs DROP COLUMN tags;
+ALTER TABLE email_jobs DROP COLUMN headers;
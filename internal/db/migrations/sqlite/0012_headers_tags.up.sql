@@ -0,0 +1,2 @@
+ALTER TABLE email_jobs ADD COLUMN headers TEXT;
+ALTER TABLE email_jobs ADD COLUMN tags TEXT;
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"database/sql"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func openPostgres(conn string) (*SQLStore, error) {
+	db, err := sql.Open("pgx", conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &SQLStore{DB: db, dialect: dialectPostgres}, nil
+}
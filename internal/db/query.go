@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"PulseSend/internal/models"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// EmailFilter selects jobs for ListEmails. Zero-valued fields do not
+// filter. Results are ordered newest first; pass the ID of the last job
+// of a page as BeforeID to fetch the next one.
+type EmailFilter struct {
+	Statuses []models.EmailStatus
+	// To matches jobs sent to the address, in to, cc or bcc, ignoring
+	// case and any display name.
+	To string
+	// Template matches the template file name exactly.
+	Template string
+	// Subject matches any subject containing it, ignoring case.
+	Subject string
+	// Tag matches jobs carrying the tag exactly.
+	Tag string
+
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// UpdatedAfter matches jobs whose last status change was at or after
+	// it; for failed jobs that is the time they failed.
+	UpdatedAfter time.Time
+
+	BeforeID int64
+	Limit    int
+}
+
+func (f EmailFilter) limit() int {
+	switch {
+	case f.Limit <= 0:
+		return DefaultListLimit
+	case f.Limit > MaxListLimit:
+		return MaxListLimit
+	default:
+		return f.Limit
+	}
+}
+
+// matches reports whether job passes the filter, ignoring paging. It
+// mirrors the WHERE clause built by ListEmails.
+func (f EmailFilter) matches(job models.EmailJob) bool {
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, st := range f.Statuses {
+			if job.Status == st {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.To != "" && !slices.Contains(job.Recipients(), models.BareAddress(f.To)) {
+		return false
+	}
+	if f.Template != "" && job.Template != f.Template {
+		return false
+	}
+	if f.Subject != "" && !strings.Contains(strings.ToLower(job.Subject), strings.ToLower(f.Subject)) {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(job.Tags, f.Tag) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && job.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !job.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	if !f.UpdatedAfter.IsZero() && job.UpdatedAt.Before(f.UpdatedAfter) {
+		return false
+	}
+	if f.BeforeID > 0 && job.ID >= f.BeforeID {
+		return false
+	}
+	return true
+}
+
+func (s *SQLStore) ListEmails(ctx context.Context, f EmailFilter) ([]models.EmailJob, error) {
+	var (
+		where []string
+		args  []any
+	)
+
+	if len(f.Statuses) > 0 {
+		marks := make([]string, len(f.Statuses))
+		for i, st := range f.Statuses {
+			marks[i] = "?"
+			args = append(args, st)
+		}
+		where = append(where, "status IN ("+strings.Join(marks, ", ")+")")
+	}
+	if f.To != "" {
+		// recipients is a JSON array of lowercased bare addresses, so the
+		// address in its JSON form only matches a whole element. Rows the
+		// 0013 migration could not fill in fall back to to_email.
+		addr := models.BareAddress(f.To)
+		quoted, err := json.Marshal(addr)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, `(recipients LIKE ? ESCAPE '\' OR (recipients IS NULL AND LOWER(to_email) = ?))`)
+		args = append(args, "%"+escapeLike(string(quoted))+"%", addr)
+	}
+	if f.Template != "" {
+		where = append(where, "template = ?")
+		args = append(args, f.Template)
+	}
+	if f.Subject != "" {
+		where = append(where, `LOWER(subject) LIKE LOWER(?) ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(f.Subject)+"%")
+	}
+	if f.Tag != "" {
+		// Tags are stored as a JSON array, so the quoted tag only matches
+		// a whole element. SQLite's LIKE ignores case; instr and strpos
+		// do not, as tags are compared exactly.
+		tag, err := json.Marshal(f.Tag)
+		if err != nil {
+			return nil, err
+		}
+		if s.dialect == dialectSQLite {
+			where = append(where, "instr(tags, ?) > 0")
+		} else {
+			where = append(where, "strpos(tags, ?) > 0")
+		}
+		args = append(args, string(tag))
+	}
+	if !f.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, s.timeArg(f.CreatedAfter))
+	}
+	if !f.CreatedBefore.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, s.timeArg(f.CreatedBefore))
+	}
+	if !f.UpdatedAfter.IsZero() {
+		where = append(where, "updated_at >= ?")
+		args = append(args, s.timeArg(f.UpdatedAfter))
+	}
+	if f.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, f.BeforeID)
+	}
+
+	query := `SELECT ` + emailColumns + ` FROM email_jobs`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, f.limit())
+
+	rows, err := s.DB.QueryContext(ctx, s.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]models.EmailJob, 0)
+	for rows.Next() {
+		job, err := scanEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// timeArg converts t for comparison against columns filled by
+// CURRENT_TIMESTAMP. SQLite stores those as "YYYY-MM-DD HH:MM:SS" text, so
+// the argument must use the same layout to compare correctly.
+func (s *SQLStore) timeArg(t time.Time) any {
+	if s.dialect == dialectSQLite {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	return t
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (m *MemoryStore) ListEmails(ctx context.Context, f EmailFilter) ([]models.EmailJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := m.sorted()
+	jobs := make([]models.EmailJob, 0)
+	for i := len(all) - 1; i >= 0 && len(jobs) < f.limit(); i-- {
+		if f.matches(all[i].job) {
+			jobs = append(jobs, copyJob(all[i].job))
+		}
+	}
+	return jobs, nil
+}
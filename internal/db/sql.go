@@ -0,0 +1,706 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"PulseSend/internal/models"
+)
+
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+var _ Store = (*SQLStore)(nil)
+
+// SQLStore implements Store on top of database/sql, for both SQLite and
+// PostgreSQL.
+type SQLStore struct {
+	DB *sql.DB
+
+	dialect dialect
+}
+
+// q rewrites a query written with "?" placeholders for the store's driver.
+func (s *SQLStore) q(query string) string {
+	if s.dialect != dialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *SQLStore) Close() {
+	if s.DB != nil {
+		_ = s.DB.Close()
+	}
+}
+
+func (s *SQLStore) InsertEmail(ctx context.Context, job *models.EmailJob) error {
+	dataJSON, err := json.Marshal(job.Data)
+	if err != nil {
+		return err
+	}
+
+	job.Status = initialStatus(job, time.Now())
+	if job.Priority == 0 {
+		job.Priority = models.PriorityNormal
+	}
+
+	var sendAt any
+	if job.SendAt != nil {
+		sendAt = job.SendAt.UTC()
+	}
+
+	var key any
+	if job.IdempotencyKey != "" {
+		key = job.IdempotencyKey
+	}
+
+	attachments, err := jsonArg(job.Attachments, len(job.Attachments))
+	if err != nil {
+		return err
+	}
+	cc, err := jsonArg(job.Cc, len(job.Cc))
+	if err != nil {
+		return err
+	}
+	bcc, err := jsonArg(job.Bcc, len(job.Bcc))
+	if err != nil {
+		return err
+	}
+	headers, err := jsonArg(job.Headers, len(job.Headers))
+	if err != nil {
+		return err
+	}
+	tags, err := jsonArg(job.Tags, len(job.Tags))
+	if err != nil {
+		return err
+	}
+	// recipients keeps the bare addresses of to, cc and bcc for the "to"
+	// filter of ListEmails; to_email may hold display names and lists.
+	rcpts := job.Recipients()
+	recipients, err := jsonArg(rcpts, len(rcpts))
+	if err != nil {
+		return err
+	}
+
+	// RETURNING works on both SQLite and Postgres; the pgx driver does not
+	// implement LastInsertId. A replayed idempotency key inserts nothing
+	// and so returns no row.
+	err = s.DB.QueryRowContext(
+		ctx,
+		s.q(`INSERT INTO email_jobs
+		 (to_email, cc, bcc, recipients, subject, template, data, status, priority, send_at, idempotency_key,
+		  from_email, from_name, reply_to, attachments, headers, tags, retries, created_at, updated_at)
+		 VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,0,CURRENT_TIMESTAMP,CURRENT_TIMESTAMP)
+		 ON CONFLICT (idempotency_key) DO NOTHING
+		 RETURNING id`),
+		job.To,
+		cc,
+		bcc,
+		recipients,
+		job.Subject,
+		job.Template,
+		string(dataJSON),
+		job.Status,
+		job.Priority,
+		sendAt,
+		key,
+		job.From,
+		job.FromName,
+		job.ReplyTo,
+		attachments,
+		headers,
+		tags,
+	).Scan(&job.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	existing, err := scanEmail(s.DB.QueryRowContext(
+		ctx,
+		s.q(`SELECT `+emailColumns+`
+		 FROM email_jobs
+		 WHERE idempotency_key = ?`),
+		job.IdempotencyKey,
+	))
+	if err != nil {
+		return err
+	}
+
+	*job = existing
+	return ErrDuplicate
+}
+
+func (s *SQLStore) UpdateStatus(
+	ctx context.Context,
+	id int64,
+	status models.EmailStatus,
+) error {
+	_, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     lease_owner = NULL,
+		     lease_until = NULL,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ?`),
+		status,
+		id,
+	)
+	return err
+}
+
+func (s *SQLStore) GetEmail(ctx context.Context, id int64) (*models.EmailJob, error) {
+	job, err := scanEmail(s.DB.QueryRowContext(
+		ctx,
+		s.q(`SELECT `+emailColumns+`
+		 FROM email_jobs
+		 WHERE id = ?`),
+		id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CancelEmail cancels a job that has not started. Its lease is dropped, so
+// a worker already holding the job fails StartJob and skips it.
+func (s *SQLStore) CancelEmail(ctx context.Context, id int64) (*models.EmailJob, error) {
+	res, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     lease_owner = NULL,
+		     lease_until = NULL,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND status IN (?, ?)`),
+		models.StatusCancelled,
+		id,
+		models.StatusScheduled,
+		models.StatusPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.afterModify(ctx, id, res)
+}
+
+// UpdateEmail edits a job that has not started. Like CancelEmail it drops
+// the lease, so the job is claimed again with the new values rather than
+// sent by a worker holding a stale copy.
+func (s *SQLStore) UpdateEmail(ctx context.Context, id int64, p EmailPatch) (*models.EmailJob, error) {
+	sets := []string{
+		"lease_owner = NULL",
+		"lease_until = NULL",
+		"updated_at = CURRENT_TIMESTAMP",
+	}
+	var args []any
+
+	if p.Subject != nil {
+		sets = append(sets, "subject = ?")
+		args = append(args, *p.Subject)
+	}
+	if p.Data != nil {
+		dataJSON, err := json.Marshal(p.Data)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, "data = ?")
+		args = append(args, string(dataJSON))
+	}
+	if p.SetSendAt {
+		var sendAt any
+		if p.SendAt != nil {
+			sendAt = p.SendAt.UTC()
+		}
+		sets = append(sets, "send_at = ?", "status = ?")
+		args = append(args, sendAt, initialStatus(&models.EmailJob{SendAt: p.SendAt}, time.Now()))
+	}
+
+	args = append(args, id, models.StatusScheduled, models.StatusPending)
+
+	res, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET `+strings.Join(sets, ", ")+`
+		 WHERE id = ? AND status IN (?, ?)`),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.afterModify(ctx, id, res)
+}
+
+// RetryEmail requeues a single failed job with a fresh retry budget. The
+// last error is kept for reference; earlier attempts stay in
+// email_attempts.
+func (s *SQLStore) RetryEmail(ctx context.Context, id int64) (*models.EmailJob, error) {
+	res, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     retries = 0,
+		     next_retry_at = NULL,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND status = ?`),
+		models.StatusPending,
+		id,
+		models.StatusFailed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.afterModify(ctx, id, res)
+}
+
+func (s *SQLStore) RetryFailed(ctx context.Context, template string, since time.Time) (int64, error) {
+	where := "status = ?"
+	args := []any{models.StatusPending, models.StatusFailed}
+
+	if template != "" {
+		where += " AND template = ?"
+		args = append(args, template)
+	}
+	if !since.IsZero() {
+		where += " AND updated_at >= ?"
+		args = append(args, s.timeArg(since))
+	}
+
+	res, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     retries = 0,
+		     next_retry_at = NULL,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE `+where),
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// afterModify returns the job changed by a guarded UPDATE, or explains
+// why no row matched.
+func (s *SQLStore) afterModify(ctx context.Context, id int64, res sql.Result) (*models.EmailJob, error) {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := s.GetEmail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return job, ErrNotModifiable
+	}
+	return job, nil
+}
+
+func (s *SQLStore) UpdateFailure(
+	ctx context.Context,
+	id int64,
+	errorMsg string,
+	class models.FailureClass,
+) error {
+	_, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     retries = retries + 1,
+		     error_msg = ?,
+		     failure_class = ?,
+		     next_retry_at = NULL,
+		     lease_owner = NULL,
+		     lease_until = NULL,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ?`),
+		models.StatusFailed,
+		errorMsg,
+		class,
+		id,
+	)
+	return err
+}
+
+// ScheduleRetry returns a job whose attempt failed to pending, counts the
+// attempt and records the error. ClaimJobs skips it until nextAt, so the
+// wait costs no worker and survives restarts.
+func (s *SQLStore) ScheduleRetry(
+	ctx context.Context,
+	id int64,
+	errorMsg string,
+	nextAt time.Time,
+) error {
+	_, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     retries = retries + 1,
+		     error_msg = ?,
+		     failure_class = ?,
+		     next_retry_at = ?,
+		     lease_owner = NULL,
+		     lease_until = NULL,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ?`),
+		models.StatusPending,
+		errorMsg,
+		models.FailureTransient,
+		nextAt.UTC(),
+		id,
+	)
+	return err
+}
+
+// ResetStale releases every job still leased by owner, moving jobs it had
+// in "processing" back to "pending". It is meant to run once at startup,
+// before the dispatcher claims anything, so that sends interrupted by a
+// crash or deploy of this instance are attempted again right away instead
+// of after their lease expires. Rows left in "processing" without any lease
+// (from versions that predate leasing) are released as well.
+func (s *SQLStore) ResetStale(ctx context.Context, owner string) (int64, error) {
+	res, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     lease_owner = NULL,
+		     lease_until = NULL,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE status IN (?, ?)
+		   AND (lease_owner = ? OR (status = ? AND lease_until IS NULL))`),
+		models.StatusPending,
+		models.StatusPending,
+		models.StatusProcessing,
+		owner,
+		models.StatusProcessing,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClaimJobs leases up to limit pending jobs to owner, oldest first. A leased
+// job is invisible to other claims until the lease expires, so a job that
+// was claimed but never started is picked up again automatically, by this
+// or any other instance.
+func (s *SQLStore) ClaimJobs(
+	ctx context.Context,
+	owner string,
+	limit int,
+	lease time.Duration,
+	order ClaimOrder,
+) ([]models.EmailJob, error) {
+	now := time.Now().UTC()
+
+	orderBy := "priority DESC, id"
+	if order == ClaimOldestFirst {
+		orderBy = "id"
+	}
+
+	// SQLite serialises writers, so the UPDATE alone is atomic. Postgres
+	// needs the candidate rows locked, and SKIP LOCKED lets concurrent
+	// instances claim disjoint batches instead of queueing on each other.
+	lock := ""
+	if s.dialect == dialectPostgres {
+		lock = "FOR UPDATE SKIP LOCKED"
+	}
+
+	rows, err := s.DB.QueryContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET lease_owner = ?,
+		     lease_until = ?,
+		     heartbeat_at = ?,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id IN (
+			SELECT id FROM email_jobs
+			WHERE status = ?
+			  AND (lease_until IS NULL OR lease_until < ?)
+			  AND (next_retry_at IS NULL OR next_retry_at <= ?)
+			ORDER BY `+orderBy+`
+			LIMIT ?
+			`+lock+`
+		 )
+		 RETURNING `+emailColumns),
+		owner,
+		now.Add(lease),
+		now,
+		models.StatusPending,
+		now,
+		now,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.EmailJob
+	for rows.Next() {
+		job, err := scanEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not guarantee order.
+	sortClaimed(jobs, order)
+	return jobs, nil
+}
+
+// StartJob moves a job claimed by owner to "processing" and renews its
+// lease. It returns ErrNotClaimed if owner no longer holds a live lease on a
+// pending job, e.g. because the lease expired and another instance claimed
+// it in the meantime.
+func (s *SQLStore) StartJob(
+	ctx context.Context,
+	id int64,
+	owner string,
+	lease time.Duration,
+) error {
+	now := time.Now().UTC()
+
+	res, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     lease_until = ?,
+		     heartbeat_at = ?,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ?
+		   AND status = ?
+		   AND lease_owner = ?
+		   AND lease_until >= ?`),
+		models.StatusProcessing,
+		now.Add(lease),
+		now,
+		id,
+		models.StatusPending,
+		owner,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotClaimed
+	}
+	return nil
+}
+
+// Heartbeat extends the lease on every unfinished job held by owner, so
+// long-running sends and jobs waiting for a free worker are not reclaimed
+// by other instances. Only live leases are extended; once a lease has
+// expired the job belongs to whoever claims it next.
+func (s *SQLStore) Heartbeat(
+	ctx context.Context,
+	owner string,
+	lease time.Duration,
+) (int64, error) {
+	now := time.Now().UTC()
+
+	res, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET lease_until = ?,
+		     heartbeat_at = ?
+		 WHERE lease_owner = ?
+		   AND status IN (?, ?)
+		   AND lease_until >= ?`),
+		now.Add(lease),
+		now,
+		owner,
+		models.StatusPending,
+		models.StatusProcessing,
+		now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ReclaimExpired returns "processing" jobs whose lease has run out to
+// "pending", so a job abandoned mid-send by a dead instance is retried.
+func (s *SQLStore) ReclaimExpired(ctx context.Context) (int64, error) {
+	res, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     lease_owner = NULL,
+		     lease_until = NULL,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE status = ?
+		   AND lease_until IS NOT NULL
+		   AND lease_until < ?`),
+		models.StatusPending,
+		models.StatusProcessing,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ReleaseDue moves scheduled jobs whose send_at has passed to "pending",
+// where the dispatcher can claim them.
+func (s *SQLStore) ReleaseDue(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.DB.ExecContext(
+		ctx,
+		s.q(`UPDATE email_jobs
+		 SET status = ?,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE status = ?
+		   AND send_at <= ?`),
+		models.StatusPending,
+		models.StatusScheduled,
+		now.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const emailColumns = `id, to_email, COALESCE(cc, ''), COALESCE(bcc, ''), subject, template, data, status, priority, send_at,
+		        COALESCE(idempotency_key, ''), COALESCE(from_email, ''),
+		        COALESCE(from_name, ''), COALESCE(reply_to, ''),
+		        COALESCE(attachments, ''), COALESCE(headers, ''), COALESCE(tags, ''),
+		        retries, next_retry_at,
+		        COALESCE(error_msg, ''), COALESCE(failure_class, ''),
+		        created_at, updated_at`
+
+// jsonArg encodes v for a JSON TEXT column, or NULL when it has no
+// elements.
+func jsonArg(v any, n int) (any, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEmail(row scanner) (models.EmailJob, error) {
+	var (
+		job      models.EmailJob
+		dataJSON string
+		status   string
+		sendAt   sql.NullTime
+		retryAt  sql.NullTime
+
+		failureClass    string
+		attachmentsJSON string
+		ccJSON, bccJSON string
+		headersJSON     string
+		tagsJSON        string
+	)
+
+	if err := row.Scan(
+		&job.ID,
+		&job.To,
+		&ccJSON,
+		&bccJSON,
+		&job.Subject,
+		&job.Template,
+		&dataJSON,
+		&status,
+		&job.Priority,
+		&sendAt,
+		&job.IdempotencyKey,
+		&job.From,
+		&job.FromName,
+		&job.ReplyTo,
+		&attachmentsJSON,
+		&headersJSON,
+		&tagsJSON,
+		&job.Retries,
+		&retryAt,
+		&job.ErrorMsg,
+		&failureClass,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	); err != nil {
+		return job, err
+	}
+
+	if err := json.Unmarshal([]byte(dataJSON), &job.Data); err != nil {
+		return job, err
+	}
+	for _, col := range []struct {
+		raw  string
+		dest any
+	}{
+		{attachmentsJSON, &job.Attachments},
+		{ccJSON, &job.Cc},
+		{bccJSON, &job.Bcc},
+		{headersJSON, &job.Headers},
+		{tagsJSON, &job.Tags},
+	} {
+		if col.raw == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(col.raw), col.dest); err != nil {
+			return job, err
+		}
+	}
+
+	job.Status = models.EmailStatus(status)
+	job.FailureClass = models.FailureClass(failureClass)
+	if sendAt.Valid {
+		t := sendAt.Time.UTC()
+		job.SendAt = &t
+	}
+	if retryAt.Valid {
+		t := retryAt.Time.UTC()
+		job.NextRetryAt = &t
+	}
+	return job, nil
+}
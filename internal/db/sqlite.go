@@ -0,0 +1,19 @@
+package db
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openSQLite(conn string) (*SQLStore, error) {
+	db, err := sql.Open("sqlite3", conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite is file-based; keep connections small/simple.
+	db.SetMaxOpenConns(1)
+
+	return &SQLStore{DB: db, dialect: dialectSQLite}, nil
+}
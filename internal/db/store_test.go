@@ -0,0 +1,731 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"PulseSend/internal/models"
+)
+
+// runStoreTests checks the behaviour every Store must share, so the memory
+// store cannot drift from the SQL ones. open returns an empty store; it is
+// called once per subtest.
+func runStoreTests(t *testing.T, open func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Store)
+	}{
+		{"InsertAndGet", testInsertAndGet},
+		{"Idempotency", testIdempotency},
+		{"ClaimAndStart", testClaimAndStart},
+		{"LeaseExpiry", testLeaseExpiry},
+		{"Retry", testRetry},
+		{"ListEmails", testListEmails},
+		{"CancelAndUpdate", testCancelAndUpdate},
+		{"ReleaseDue", testReleaseDue},
+		{"ResetStale", testResetStale},
+		{"RetryFailed", testRetryFailed},
+		{"Attempts", testAttempts},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, open(t))
+		})
+	}
+}
+
+func testInsertAndGet(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	job := newJob("Ann Lee <ann@example.com>")
+	job.Cc = []string{"cc@example.com"}
+	job.Bcc = []string{"bcc@example.com"}
+	job.Data = map[string]interface{}{"Name": "Ann", "Count": float64(3)}
+	job.From = "billing@example.com"
+	job.FromName = "Billing"
+	job.ReplyTo = "support@example.com"
+	job.Headers = map[string]string{"X-Campaign-Id": "spring"}
+	job.Tags = []string{"newsletter", "campaign:spring"}
+	job.Attachments = []models.Attachment{{
+		Filename: "a.pdf", ContentType: "application/pdf", Size: 3,
+		SHA256: strings.Repeat("ab", 32),
+	}}
+	mustInsert(t, s, job)
+
+	if job.ID == 0 || job.Status != models.StatusPending {
+		t.Fatalf("inserted job has id %d, status %s", job.ID, job.Status)
+	}
+
+	got, err := s.GetEmail(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.To != job.To || got.Subject != job.Subject || got.Template != job.Template ||
+		got.Priority != job.Priority || got.From != job.From || got.FromName != job.FromName ||
+		got.ReplyTo != job.ReplyTo {
+		t.Errorf("GetEmail = %+v, want %+v", got, job)
+	}
+	if fmt.Sprint(got.Cc, got.Bcc, got.Tags) != fmt.Sprint(job.Cc, job.Bcc, job.Tags) {
+		t.Errorf("cc/bcc/tags = %v %v %v", got.Cc, got.Bcc, got.Tags)
+	}
+	if got.Data["Name"] != "Ann" || got.Data["Count"] != float64(3) {
+		t.Errorf("data = %v", got.Data)
+	}
+	if got.Headers["X-Campaign-Id"] != "spring" {
+		t.Errorf("headers = %v", got.Headers)
+	}
+	if len(got.Attachments) != 1 || got.Attachments[0].SHA256 != job.Attachments[0].SHA256 ||
+		got.Attachments[0].Filename != "a.pdf" || got.Attachments[0].Size != 3 {
+		t.Errorf("attachments = %+v", got.Attachments)
+	}
+
+	if _, err := s.GetEmail(ctx, job.ID+1000); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetEmail(missing) error = %v, want ErrNotFound", err)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	scheduled := newJob("later@example.com")
+	scheduled.SendAt = &future
+	mustInsert(t, s, scheduled)
+	if scheduled.Status != models.StatusScheduled {
+		t.Errorf("job with future send_at has status %s", scheduled.Status)
+	}
+}
+
+func testIdempotency(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	first := newJob("a@example.com")
+	first.IdempotencyKey = "key-1"
+	mustInsert(t, s, first)
+
+	again := newJob("b@example.com")
+	again.IdempotencyKey = "key-1"
+	if err := s.InsertEmail(ctx, again); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("second insert error = %v, want ErrDuplicate", err)
+	}
+	if again.ID != first.ID || again.To != first.To {
+		t.Errorf("duplicate insert returned %d %s, want the original %d %s", again.ID, again.To, first.ID, first.To)
+	}
+
+	other := newJob("c@example.com")
+	other.IdempotencyKey = "key-2"
+	mustInsert(t, s, other)
+	if other.ID == first.ID {
+		t.Error("different keys share a job")
+	}
+}
+
+func testClaimAndStart(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	low := newJob("low@example.com")
+	low.Priority = models.PriorityLow
+	mustInsert(t, s, low)
+	high := newJob("high@example.com")
+	high.Priority = models.PriorityHigh
+	mustInsert(t, s, high)
+	normal := newJob("normal@example.com")
+	mustInsert(t, s, normal)
+
+	jobs, err := s.ClaimJobs(ctx, "a", 2, time.Minute, ClaimByPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := jobIDs(jobs); ids != fmt.Sprint([]int64{high.ID, normal.ID}) {
+		t.Fatalf("claimed %s, want high then normal", ids)
+	}
+
+	// Claimed jobs are not handed out twice.
+	jobs, err = s.ClaimJobs(ctx, "b", 10, time.Minute, ClaimByPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := jobIDs(jobs); ids != fmt.Sprint([]int64{low.ID}) {
+		t.Fatalf("second claim got %s, want only low", ids)
+	}
+
+	if err := s.StartJob(ctx, high.ID, "b", time.Minute); !errors.Is(err, ErrNotClaimed) {
+		t.Errorf("StartJob by another owner error = %v, want ErrNotClaimed", err)
+	}
+	if err := s.StartJob(ctx, high.ID, "a", time.Minute); err != nil {
+		t.Fatalf("StartJob: %v", err)
+	}
+	if err := s.StartJob(ctx, high.ID, "a", time.Minute); !errors.Is(err, ErrNotClaimed) {
+		t.Errorf("second StartJob error = %v, want ErrNotClaimed", err)
+	}
+	assertStatus(t, s, high.ID, models.StatusProcessing)
+
+	if n, err := s.Heartbeat(ctx, "a", time.Minute); err != nil || n != 2 {
+		t.Errorf("Heartbeat(a) = %d, %v, want 2 leases", n, err)
+	}
+
+	if err := s.UpdateStatus(ctx, high.ID, models.StatusSent); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, s, high.ID, models.StatusSent)
+	if n, err := s.Heartbeat(ctx, "a", time.Minute); err != nil || n != 1 {
+		t.Errorf("Heartbeat(a) after send = %d, %v, want 1 lease", n, err)
+	}
+}
+
+func testLeaseExpiry(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	started := newJob("started@example.com")
+	mustInsert(t, s, started)
+	claimed := newJob("claimed@example.com")
+	mustInsert(t, s, claimed)
+
+	const lease = 50 * time.Millisecond
+	if _, err := s.ClaimJobs(ctx, "dead", 10, lease, ClaimByPriority); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartJob(ctx, started.ID, "dead", lease); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * lease)
+
+	// An expired claim can be taken by another instance straight away; an
+	// expired processing lease has to be reclaimed first.
+	jobs, err := s.ClaimJobs(ctx, "live", 10, time.Minute, ClaimByPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := jobIDs(jobs); ids != fmt.Sprint([]int64{claimed.ID}) {
+		t.Fatalf("claim after expiry got %s, want the unstarted job", ids)
+	}
+
+	if n, err := s.ReclaimExpired(ctx); err != nil || n != 1 {
+		t.Fatalf("ReclaimExpired = %d, %v, want 1", n, err)
+	}
+	assertStatus(t, s, started.ID, models.StatusPending)
+
+	jobs, err = s.ClaimJobs(ctx, "live", 10, time.Minute, ClaimByPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := jobIDs(jobs); ids != fmt.Sprint([]int64{started.ID}) {
+		t.Fatalf("claim after reclaim got %s, want the reclaimed job", ids)
+	}
+	if err := s.StartJob(ctx, started.ID, "dead", time.Minute); !errors.Is(err, ErrNotClaimed) {
+		t.Errorf("StartJob by the old owner error = %v, want ErrNotClaimed", err)
+	}
+}
+
+func testRetry(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	job := newJob("retry@example.com")
+	mustInsert(t, s, job)
+	startJob(t, s, job.ID)
+
+	const wait = 100 * time.Millisecond
+	if err := s.ScheduleRetry(ctx, job.ID, "451 try later", time.Now().Add(wait)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetEmail(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusPending || got.Retries != 1 || got.ErrorMsg != "451 try later" ||
+		got.FailureClass != models.FailureTransient || got.NextRetryAt == nil {
+		t.Fatalf("after ScheduleRetry: %+v", got)
+	}
+
+	if jobs, err := s.ClaimJobs(ctx, "w", 10, time.Minute, ClaimByPriority); err != nil || len(jobs) != 0 {
+		t.Fatalf("claimed %d jobs before next_retry_at (err %v)", len(jobs), err)
+	}
+	time.Sleep(wait + 20*time.Millisecond)
+	startJob(t, s, job.ID)
+
+	if err := s.UpdateFailure(ctx, job.ID, "550 user unknown", models.FailurePermanent); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.GetEmail(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusFailed || got.Retries != 2 || got.FailureClass != models.FailurePermanent {
+		t.Fatalf("after UpdateFailure: %+v", got)
+	}
+
+	got, err = s.RetryEmail(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusPending || got.Retries != 0 || got.NextRetryAt != nil {
+		t.Fatalf("after RetryEmail: %+v", got)
+	}
+	if _, err := s.RetryEmail(ctx, job.ID); !errors.Is(err, ErrNotModifiable) {
+		t.Errorf("RetryEmail on a pending job error = %v, want ErrNotModifiable", err)
+	}
+	startJob(t, s, job.ID)
+}
+
+func testListEmails(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	ann := newJob("Ann@Example.com")
+	ann.Subject = "Password reset"
+	ann.Tags = []string{"auth"}
+	mustInsert(t, s, ann)
+	bob := newJob("bob@example.com")
+	bob.Subject = "100% off"
+	bob.Template = "promo.html"
+	bob.Tags = []string{"newsletter", "promo"}
+	mustInsert(t, s, bob)
+	carl := newJob("carl@example.com")
+	carl.Subject = "Your 100 points"
+	carl.Tags = []string{"Newsletter-weekly"}
+	mustInsert(t, s, carl)
+	if _, err := s.CancelEmail(ctx, carl.ID); err != nil {
+		t.Fatal(err)
+	}
+	dana := newJob(`"Dana Lee" <dana@example.com>, eve@example.com`)
+	dana.Cc = []string{"frank@example.com"}
+	dana.Bcc = []string{`"Gil" <Gil@example.com>`}
+	mustInsert(t, s, dana)
+
+	for _, tc := range []struct {
+		name   string
+		filter EmailFilter
+		want   []int64
+	}{
+		{"all", EmailFilter{}, []int64{dana.ID, carl.ID, bob.ID, ann.ID}},
+		{"status", EmailFilter{Statuses: []models.EmailStatus{models.StatusCancelled}}, []int64{carl.ID}},
+		{"statuses", EmailFilter{Statuses: []models.EmailStatus{models.StatusPending, models.StatusSent}}, []int64{dana.ID, bob.ID, ann.ID}},
+		{"to ignores case", EmailFilter{To: "ann@example.COM"}, []int64{ann.ID}},
+		{"to ignores display name", EmailFilter{To: "Ann <ann@example.com>"}, []int64{ann.ID}},
+		{"to behind display name", EmailFilter{To: "dana@example.com"}, []int64{dana.ID}},
+		{"to in list", EmailFilter{To: "eve@example.com"}, []int64{dana.ID}},
+		{"to in cc", EmailFilter{To: "frank@example.com"}, []int64{dana.ID}},
+		{"to in bcc", EmailFilter{To: "gil@example.com"}, []int64{dana.ID}},
+		{"to is exact", EmailFilter{To: "example.com"}, []int64{}},
+		{"to wildcard is literal", EmailFilter{To: "%@example.com"}, []int64{}},
+		{"template", EmailFilter{Template: "promo.html"}, []int64{bob.ID}},
+		{"subject substring", EmailFilter{Subject: "RESET"}, []int64{ann.ID}},
+		{"subject wildcard is literal", EmailFilter{Subject: "100%"}, []int64{bob.ID}},
+		{"tag", EmailFilter{Tag: "newsletter"}, []int64{bob.ID}},
+		{"tag is exact", EmailFilter{Tag: "news"}, []int64{}},
+		{"tag keeps case", EmailFilter{Tag: "Newsletter-weekly"}, []int64{carl.ID}},
+		{"tag is case-sensitive", EmailFilter{Tag: "Promo"}, []int64{}},
+		{"limit", EmailFilter{Limit: 2}, []int64{dana.ID, carl.ID}},
+		{"cursor", EmailFilter{BeforeID: bob.ID}, []int64{ann.ID}},
+	} {
+		jobs, err := s.ListEmails(ctx, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if ids := jobIDs(jobs); ids != fmt.Sprint(tc.want) {
+			t.Errorf("%s: got %s, want %v", tc.name, ids, tc.want)
+		}
+	}
+}
+
+func testCancelAndUpdate(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	job := newJob("edit@example.com")
+	mustInsert(t, s, job)
+
+	subject := "Edited"
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	got, err := s.UpdateEmail(ctx, job.ID, EmailPatch{
+		Subject:   &subject,
+		Data:      map[string]interface{}{"Name": "Edited"},
+		SetSendAt: true,
+		SendAt:    &future,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Subject != "Edited" || got.Data["Name"] != "Edited" || got.Status != models.StatusScheduled ||
+		got.SendAt == nil || !got.SendAt.Equal(future) {
+		t.Fatalf("after UpdateEmail: %+v", got)
+	}
+
+	got, err = s.UpdateEmail(ctx, job.ID, EmailPatch{SetSendAt: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusPending || got.SendAt != nil {
+		t.Fatalf("after clearing send_at: %+v", got)
+	}
+
+	if _, err := s.UpdateEmail(ctx, job.ID+1000, EmailPatch{Subject: &subject}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateEmail(missing) error = %v, want ErrNotFound", err)
+	}
+
+	started := newJob("started@example.com")
+	mustInsert(t, s, started)
+	if _, err := s.CancelEmail(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	startJob(t, s, started.ID)
+
+	for _, id := range []int64{job.ID, started.ID} {
+		if _, err := s.CancelEmail(ctx, id); !errors.Is(err, ErrNotModifiable) {
+			t.Errorf("CancelEmail(%d) error = %v, want ErrNotModifiable", id, err)
+		}
+		if _, err := s.UpdateEmail(ctx, id, EmailPatch{Subject: &subject}); !errors.Is(err, ErrNotModifiable) {
+			t.Errorf("UpdateEmail(%d) error = %v, want ErrNotModifiable", id, err)
+		}
+	}
+	assertStatus(t, s, job.ID, models.StatusCancelled)
+}
+
+func testReleaseDue(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	soon := now.Add(time.Minute)
+	due := newJob("due@example.com")
+	due.SendAt = &soon
+	mustInsert(t, s, due)
+
+	later := now.Add(time.Hour)
+	notDue := newJob("later@example.com")
+	notDue.SendAt = &later
+	mustInsert(t, s, notDue)
+
+	if jobs, err := s.ClaimJobs(ctx, "w", 10, time.Minute, ClaimByPriority); err != nil || len(jobs) != 0 {
+		t.Fatalf("claimed %d scheduled jobs (err %v)", len(jobs), err)
+	}
+
+	if n, err := s.ReleaseDue(ctx, now.Add(2*time.Minute)); err != nil || n != 1 {
+		t.Fatalf("ReleaseDue = %d, %v, want 1", n, err)
+	}
+	assertStatus(t, s, due.ID, models.StatusPending)
+	assertStatus(t, s, notDue.ID, models.StatusScheduled)
+}
+
+func testResetStale(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	mine := newJob("mine@example.com")
+	mustInsert(t, s, mine)
+	startJob(t, s, mine.ID)
+
+	other := newJob("other@example.com")
+	mustInsert(t, s, other)
+	if _, err := s.ClaimJobs(ctx, "other", 10, time.Minute, ClaimByPriority); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the restarted owner's leases are released; other instances
+	// keep theirs.
+	if n, err := s.ResetStale(ctx, "w"); err != nil || n != 1 {
+		t.Fatalf("ResetStale = %d, %v, want 1", n, err)
+	}
+	assertStatus(t, s, mine.ID, models.StatusPending)
+
+	jobs, err := s.ClaimJobs(ctx, "w", 10, time.Minute, ClaimByPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := jobIDs(jobs); ids != fmt.Sprint([]int64{mine.ID}) {
+		t.Fatalf("claim after ResetStale got %s, want only the released job", ids)
+	}
+}
+
+func testRetryFailed(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	var failed []int64
+	for _, tmpl := range []string{"a.html", "a.html", "b.html"} {
+		job := newJob("failed@example.com")
+		job.Template = tmpl
+		mustInsert(t, s, job)
+		startJob(t, s, job.ID)
+		if err := s.UpdateFailure(ctx, job.ID, "550 no", models.FailurePermanent); err != nil {
+			t.Fatal(err)
+		}
+		failed = append(failed, job.ID)
+	}
+	pending := newJob("pending@example.com")
+	pending.Template = "a.html"
+	mustInsert(t, s, pending)
+
+	if n, err := s.RetryFailed(ctx, "a.html", time.Time{}); err != nil || n != 2 {
+		t.Fatalf("RetryFailed(a.html) = %d, %v, want 2", n, err)
+	}
+	assertStatus(t, s, failed[2], models.StatusFailed)
+
+	if n, err := s.RetryFailed(ctx, "", time.Now().Add(time.Hour)); err != nil || n != 0 {
+		t.Errorf("RetryFailed(since the future) = %d, %v, want 0", n, err)
+	}
+	if n, err := s.RetryFailed(ctx, "", time.Time{}); err != nil || n != 1 {
+		t.Errorf("RetryFailed(all) = %d, %v, want 1", n, err)
+	}
+
+	for _, id := range failed {
+		job, err := s.GetEmail(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != models.StatusPending || job.Retries != 0 {
+			t.Errorf("job %d after RetryFailed: status %s, retries %d", id, job.Status, job.Retries)
+		}
+	}
+}
+
+func testAttempts(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	job := newJob("attempts@example.com")
+	mustInsert(t, s, job)
+
+	started := time.Now().UTC().Truncate(time.Second)
+	for i, code := range []int{451, 250} {
+		a := &models.EmailAttempt{
+			JobID:        job.ID,
+			WorkerID:     "w/0",
+			SMTPHost:     "smtp.example.com",
+			StartedAt:    started,
+			FinishedAt:   started.Add(time.Second),
+			Success:      code == 250,
+			ResponseCode: code,
+		}
+		if err := s.RecordAttempt(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+		if a.ID == 0 || a.Attempt != i+1 {
+			t.Errorf("attempt %d recorded with id %d, number %d", i+1, a.ID, a.Attempt)
+		}
+	}
+
+	attempts, err := s.ListAttempts(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0].ResponseCode != 451 || attempts[1].ResponseCode != 250 ||
+		!attempts[1].Success || attempts[0].WorkerID != "w/0" || !attempts[0].StartedAt.Equal(started) {
+		t.Errorf("ListAttempts = %+v", attempts)
+	}
+
+	if attempts, err := s.ListAttempts(ctx, job.ID+1000); err != nil || len(attempts) != 0 {
+		t.Errorf("ListAttempts(other job) = %+v, %v", attempts, err)
+	}
+}
+
+func newJob(to string) *models.EmailJob {
+	return &models.EmailJob{
+		To:       to,
+		Subject:  "Hello",
+		Template: "email.html",
+		Data:     map[string]interface{}{},
+		Priority: models.PriorityNormal,
+	}
+}
+
+func mustInsert(t *testing.T, s Store, job *models.EmailJob) {
+	t.Helper()
+	if err := s.InsertEmail(context.Background(), job); err != nil {
+		t.Fatalf("InsertEmail(%s): %v", job.To, err)
+	}
+}
+
+// startJob claims and starts the job, which must be the only one
+// claimable.
+func startJob(t *testing.T, s Store, id int64) {
+	t.Helper()
+	ctx := context.Background()
+	jobs, err := s.ClaimJobs(ctx, "w", 10, time.Minute, ClaimByPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := jobIDs(jobs); ids != fmt.Sprint([]int64{id}) {
+		t.Fatalf("claimed %s, want [%d]", ids, id)
+	}
+	if err := s.StartJob(ctx, id, "w", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertStatus(t *testing.T, s Store, id int64, want models.EmailStatus) {
+	t.Helper()
+	job, err := s.GetEmail(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != want {
+		t.Errorf("job %d has status %s, want %s", id, job.Status, want)
+	}
+}
+
+func jobIDs(jobs []models.EmailJob) string {
+	ids := make([]int64, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.ID
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) Store { return NewMemory() })
+}
+
+// openSQLiteTest returns a migrated store in a temporary file.
+func openSQLiteTest(t *testing.T) *SQLStore {
+	t.Helper()
+	store := newSQLiteTest(t)
+	if _, err := store.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// newSQLiteTest returns an unmigrated store in a temporary file.
+func newSQLiteTest(t *testing.T) *SQLStore {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "pulsesend.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) Store { return openSQLiteTest(t) })
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	testMigrations(t, newSQLiteTest(t))
+}
+
+// openPostgresTest returns a migrated store in a fresh schema of the
+// database at PULSESEND_TEST_POSTGRES_URL, dropped when the test ends. The
+// test is skipped if the variable is unset.
+func openPostgresTest(t *testing.T) *SQLStore {
+	t.Helper()
+	store := newPostgresTest(t)
+	if _, err := store.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// newPostgresTest is openPostgresTest without the migrations.
+func newPostgresTest(t *testing.T) *SQLStore {
+	t.Helper()
+	url := os.Getenv("PULSESEND_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("PULSESEND_TEST_POSTGRES_URL not set")
+	}
+
+	admin, err := sql.Open("pgx", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("pulsesend_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	store, err := Open(url + sep + "search_path=" + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestPostgresStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) Store { return openPostgresTest(t) })
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	testMigrations(t, newPostgresTest(t))
+}
+
+// testMigrations checks the status of an empty database, applies every
+// migration, rolls them all back and applies them again.
+func testMigrations(t *testing.T, s *SQLStore) {
+	ctx := context.Background()
+
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if got := pendingCount(states); len(states) != len(migrations) || got != len(migrations) {
+		t.Errorf("status of an empty database: %d of %d pending, want all %d", got, len(states), len(migrations))
+	}
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := s.migrationTableExists(ctx, conn)
+	conn.Close()
+	if err != nil || exists {
+		t.Errorf("schema_migrations exists after MigrationStatus (%v)", err)
+	}
+
+	n, err := s.MigrateUp(ctx)
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if n != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", n, len(migrations))
+	}
+	if states, err := s.MigrationStatus(ctx); err != nil || pendingCount(states) != 0 {
+		t.Errorf("status after MigrateUp: %d pending, %v", pendingCount(states), err)
+	}
+
+	n, err = s.MigrateDown(ctx, len(migrations))
+	if err != nil {
+		t.Fatalf("MigrateDown: %v", err)
+	}
+	if n != len(migrations) {
+		t.Errorf("rolled back %d migrations, want %d", n, len(migrations))
+	}
+
+	n, err = s.MigrateUp(ctx)
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if n != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", n, len(migrations))
+	}
+
+	if n, err := s.MigrateUp(ctx); err != nil || n != 0 {
+		t.Errorf("second MigrateUp = %d, %v, want nothing to do", n, err)
+	}
+	mustInsert(t, s, newJob("after-migrate@example.com"))
+}
+
+func pendingCount(states []MigrationState) int {
+	n := 0
+	for _, st := range states {
+		if st.AppliedAt == nil {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,163 @@
+package dispatcher
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"PulseSend/internal/db"
+	"PulseSend/internal/models"
+)
+
+// Options controls how a Dispatcher claims work.
+type Options struct {
+	// Owner identifies this instance in lease_owner. It must be unique
+	// across all replicas sharing the database.
+	Owner string
+	// Batch is the maximum number of jobs claimed per poll.
+	Batch int
+	// Lease is how long a claimed job stays reserved for this instance
+	// without a heartbeat.
+	Lease time.Duration
+	// PollInterval is how long to wait before polling again when the
+	// queue is empty.
+	PollInterval time.Duration
+	// HeartbeatInterval is how often leases held by this instance are
+	// renewed. It should be well below Lease.
+	HeartbeatInterval time.Duration
+	// FairShare protects low-priority jobs from starvation: one in every
+	// FairShare claimed jobs is taken oldest-first, regardless of
+	// priority. Zero disables it, so priority is strict.
+	FairShare int
+}
+
+// Dispatcher claims pending jobs from the database and hands them to the
+// worker pool. The database is the queue: the channel passed to Run only
+// ever holds jobs that are already leased to this instance, so nothing is
+// lost on restart and no two instances send the same job.
+type Dispatcher struct {
+	store db.Store
+	log   *zap.Logger
+	opts  Options
+
+	wake chan struct{}
+
+	// claimed counts jobs claimed so far, to spread FairShare slots
+	// evenly across batches of any size. Only touched by Run.
+	claimed int
+}
+
+func New(store db.Store, logger *zap.Logger, opts Options) *Dispatcher {
+	return &Dispatcher{
+		store: store,
+		log:   logger,
+		opts:  opts,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the dispatcher so newly inserted jobs are claimed without
+// waiting for the next poll. It never blocks.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run claims jobs until ctx is cancelled and sends them on out. out is
+// closed when Run returns.
+func (d *Dispatcher) Run(ctx context.Context, out chan<- models.EmailJob) {
+	defer close(out)
+
+	d.log.Info("dispatcher started",
+		zap.String("owner", d.opts.Owner),
+		zap.Int("batch", d.opts.Batch),
+		zap.Duration("lease", d.opts.Lease),
+		zap.Duration("poll_interval", d.opts.PollInterval),
+		zap.Duration("heartbeat_interval", d.opts.HeartbeatInterval),
+		zap.Int("fair_share", d.opts.FairShare),
+	)
+
+	go d.heartbeat(ctx)
+
+	for {
+		if n, err := d.store.ReclaimExpired(ctx); err != nil {
+			d.log.Error("failed to reclaim expired jobs", zap.Error(err))
+		} else if n > 0 {
+			d.log.Warn("reclaimed expired jobs", zap.Int64("count", n))
+		}
+
+		jobs := d.claim(ctx)
+
+		for _, job := range jobs {
+			select {
+			case out <- job:
+			case <-ctx.Done():
+				// Unsent jobs keep their lease and are claimed again
+				// once it expires.
+				return
+			}
+		}
+
+		// A full batch means there is probably more work waiting.
+		if len(jobs) == d.opts.Batch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			d.log.Info("dispatcher shutting down")
+			return
+		case <-d.wake:
+		case <-time.After(d.opts.PollInterval):
+		}
+	}
+}
+
+// claim leases the next batch. Most of it is taken by priority; the share
+// reserved by FairShare goes to the oldest pending jobs, so a steady stream
+// of high-priority mail still lets bulk campaigns make progress.
+func (d *Dispatcher) claim(ctx context.Context) []models.EmailJob {
+	fair := 0
+	if k := d.opts.FairShare; k > 0 {
+		fair = (d.claimed+d.opts.Batch)/k - d.claimed/k
+	}
+
+	jobs, err := d.store.ClaimJobs(ctx, d.opts.Owner, d.opts.Batch-fair, d.opts.Lease, db.ClaimByPriority)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.log.Error("failed to claim jobs", zap.Error(err))
+		}
+		return nil
+	}
+
+	if fair > 0 {
+		oldest, err := d.store.ClaimJobs(ctx, d.opts.Owner, fair, d.opts.Lease, db.ClaimOldestFirst)
+		if err != nil && ctx.Err() == nil {
+			d.log.Error("failed to claim oldest jobs", zap.Error(err))
+		}
+		jobs = append(jobs, oldest...)
+	}
+
+	d.claimed += len(jobs)
+	return jobs
+}
+
+// heartbeat renews this instance's leases until ctx is cancelled.
+func (d *Dispatcher) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.store.Heartbeat(ctx, d.opts.Owner, d.opts.Lease); err != nil && ctx.Err() == nil {
+				d.log.Error("lease heartbeat failed", zap.Error(err))
+			}
+		}
+	}
+}
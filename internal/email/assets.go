@@ -0,0 +1,76 @@
+package email
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/gomail.v2"
+)
+
+// assetRef matches src and background attributes pointing into the assets
+// directory, e.g. src="assets/logo.png".
+var assetRef = regexp.MustCompile(`\b(src|background)=(["'])` + assetsDir + `/([^"']+)(["'])`)
+
+// embedAssets rewrites references to template assets in a rendered body to
+// cid: URLs and embeds the assets in m, so images show without fetching
+// anything remote. Each asset is embedded once however often it is used.
+func (s *Sender) embedAssets(m *gomail.Message, body string) (string, error) {
+	var (
+		missing  string
+		embedded = make(map[string]bool)
+	)
+
+	body = assetRef.ReplaceAllStringFunc(body, func(ref string) string {
+		sub := assetRef.FindStringSubmatch(ref)
+		attr, quote, name := sub[1], sub[2], sub[3]
+		if sub[4] != quote {
+			return ref
+		}
+
+		data, ok := s.Templates.Asset(name)
+		if !ok {
+			missing = name
+			return ref
+		}
+
+		cid := contentID(name)
+		if !embedded[name] {
+			embedded[name] = true
+			embed(m, name, cid, data)
+		}
+		return attr + "=" + quote + "cid:" + cid + quote
+	})
+
+	if missing != "" {
+		return "", fmt.Errorf("asset %s not found in %s/", missing, assetsDir)
+	}
+	return body, nil
+}
+
+// contentID turns an asset path into a Content-ID: nested paths would
+// otherwise collide on their base name.
+func contentID(name string) string {
+	return strings.NewReplacer("/", ".", " ", "_").Replace(name)
+}
+
+func embed(m *gomail.Message, name, cid string, data []byte) {
+	ct := mime.TypeByExtension(path.Ext(name))
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+
+	m.Embed(cid,
+		gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		}),
+		gomail.SetHeader(map[string][]string{
+			"Content-Type": {ct},
+			"Content-ID":   {"<" + cid + ">"},
+		}),
+	)
+}
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"errors"
+	"regexp"
+
+	"PulseSend/internal/models"
+)
+
+// permanentError marks a failure that retrying the same job cannot fix,
+// such as a template that does not parse.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so that Classify reports it as permanent.
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// connError marks a failure to set up the SMTP session: dialling, EHLO,
+// STARTTLS or AUTH. Any reply it carries, e.g. 535 for bad credentials,
+// is about our connection rather than the message, so it is transient:
+// failing every queued job over it would dead-letter the whole queue.
+type connError struct {
+	err error
+}
+
+func (e *connError) Error() string { return "smtp connect error: " + e.err.Error() }
+func (e *connError) Unwrap() error { return e.err }
+
+// enhancedPattern matches an RFC 3463 enhanced status code at the start of
+// the reply text, e.g. "5.1.1" in "550 5.1.1 user unknown".
+var enhancedPattern = regexp.MustCompile(`^([245])\.[0-9]{1,3}\.[0-9]{1,3}\b`)
+
+// EnhancedCode returns the enhanced status code that starts an SMTP reply
+// text, or "" if there is none.
+func EnhancedCode(text string) string {
+	return enhancedPattern.FindString(text)
+}
+
+// Classify decides whether a send error is worth retrying. Template errors
+// and 5xx replies to MAIL, RCPT or DATA (or a 5.x.x enhanced code) are
+// permanent; 4xx replies, connection setup failures and errors without a
+// reply, such as timeouts, are transient.
+func Classify(err error) models.FailureClass {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return models.FailurePermanent
+	}
+	var conn *connError
+	if errors.As(err, &conn) {
+		return models.FailureTransient
+	}
+
+	code, text := ParseReply(err)
+	if code >= 500 {
+		return models.FailurePermanent
+	}
+	if enhanced := EnhancedCode(text); enhanced != "" && enhanced[0] == '5' {
+		return models.FailurePermanent
+	}
+	return models.FailureTransient
+}
@@ -0,0 +1,31 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+
+	"PulseSend/internal/models"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want models.FailureClass
+	}{
+		{"rcpt 550", &textproto.Error{Code: 550, Msg: "5.1.1 user unknown"}, models.FailurePermanent},
+		{"rcpt 451", &textproto.Error{Code: 451, Msg: "4.3.0 try later"}, models.FailureTransient},
+		{"enhanced 5.x.x", &textproto.Error{Code: 452, Msg: "5.2.2 mailbox full"}, models.FailurePermanent},
+		{"flattened reply", errors.New("gomail: could not send email 1: 550 5.1.1 user unknown"), models.FailurePermanent},
+		{"template", permanent(errors.New("template not found")), models.FailurePermanent},
+		{"timeout", errors.New("i/o timeout"), models.FailureTransient},
+		{"auth 535", &connError{err: &textproto.Error{Code: 535, Msg: "5.7.8 bad credentials"}}, models.FailureTransient},
+		{"connect 554", fmt.Errorf("smtp send error: %w", &connError{err: &textproto.Error{Code: 554, Msg: "blocked"}}), models.FailureTransient},
+	} {
+		if got := Classify(tc.err); got != tc.want {
+			t.Errorf("%s: Classify(%v) = %s, want %s", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+
+	"PulseSend/internal/metrics"
+	"PulseSend/internal/models"
+)
+
+// Conn is a worker's SMTP connection. It stays open and authenticated
+// between messages, so TCP, TLS and AUTH are paid once per connection
+// instead of once per email. A message the server rejects only resets the
+// session; the connection is replaced after an I/O or protocol error,
+// after Sender.MaxMessages messages and once it has been idle for
+// Sender.IdleTimeout.
+type Conn struct {
+	sender *Sender
+
+	client   *smtp.Client
+	conn     net.Conn
+	sent     int
+	lastUsed time.Time
+}
+
+// Attempt makes a single delivery attempt and describes it. Retrying is
+// up to the caller, which persists the job's next attempt time instead of
+// waiting here.
+func (c *Conn) Attempt(job models.EmailJob) (models.EmailAttempt, error) {
+	started := time.Now().UTC()
+	refused, err := c.send(job)
+	a := c.sender.attempt(job, started, err)
+	if refused != nil {
+		// Sent to the others; keep who did not get it.
+		a.Error = refused.Error()
+	}
+	return a, err
+}
+
+// Send renders the template and sends the email. It succeeds if at least
+// one recipient accepted it; Attempt also reports those refused.
+func (c *Conn) Send(job models.EmailJob) error {
+	_, err := c.send(job)
+	return err
+}
+
+func (c *Conn) send(job models.EmailJob) (refused, err error) {
+	m, to, err := c.sender.message(job)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := c.sender.signed(job, m)
+	if err != nil {
+		return nil, err
+	}
+
+	from := c.sender.from(job)
+
+	reused := c.client != nil
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+	c.deadline(c.sender.timeout())
+
+	err = c.client.Mail(from)
+
+	// A pooled connection may have been dropped by the server while it
+	// sat idle. An error without an SMTP reply at MAIL means nothing of
+	// the message was sent yet, so try once more on a fresh connection.
+	// Later failures are left to the retry policy instead: once DATA has
+	// started the server may have accepted the message already.
+	if err != nil && reused && !isReply(err) {
+		c.close("error")
+		if err = c.open(); err != nil {
+			return nil, err
+		}
+		c.deadline(c.sender.timeout())
+		err = c.client.Mail(from)
+	}
+	if err == nil {
+		refused, err = deliver(c.client, to, msg)
+	}
+
+	if err != nil {
+		c.reset(err)
+		return nil, fmt.Errorf("smtp send error: %w", err)
+	}
+
+	c.sent++
+	c.lastUsed = time.Now()
+	if reused {
+		metrics.SMTPConnReuses.Inc()
+	}
+	if c.sender.MaxMessages > 0 && c.sent >= c.sender.MaxMessages {
+		c.close("max_messages")
+	}
+	return refused, nil
+}
+
+// CloseIdle closes the connection if it has not been used for
+// Sender.IdleTimeout. Workers call it periodically while waiting for jobs.
+func (c *Conn) CloseIdle() {
+	if c.client != nil && c.sender.IdleTimeout > 0 && time.Since(c.lastUsed) >= c.sender.IdleTimeout {
+		c.close("idle")
+	}
+}
+
+// Close closes the connection, if open.
+func (c *Conn) Close() {
+	c.close("shutdown")
+}
+
+// open dials unless a usable connection is already open. Failures are
+// returned as *connError.
+func (c *Conn) open() error {
+	c.CloseIdle()
+	if c.client != nil {
+		return nil
+	}
+
+	client, conn, err := c.sender.dial()
+	metrics.SMTPDials.Inc()
+	if err != nil {
+		metrics.SMTPDialErrors.Inc()
+		return &connError{err: err}
+	}
+
+	c.client = client
+	c.conn = conn
+	c.sent = 0
+	c.lastUsed = time.Now()
+	metrics.SMTPConnsOpen.Inc()
+	return nil
+}
+
+// reset readies the session for the next message after a failed one. A
+// reply to MAIL, RCPT or DATA leaves the session usable once RSET aborts
+// the transaction. Anything else, or a 421 that announces the server is
+// closing, means dialing again next time.
+func (c *Conn) reset(err error) {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code != 421 && c.client.Reset() == nil {
+		c.lastUsed = time.Now()
+		metrics.SMTPConnResets.Inc()
+		return
+	}
+	c.close("error")
+}
+
+// isReply reports whether err is a reply from the server, as opposed to
+// an I/O or protocol error.
+func isReply(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply)
+}
+
+// deadline bounds what is left of the current exchange, so a server that
+// stalls or silently drops the connection cannot block the worker.
+func (c *Conn) deadline(d time.Duration) {
+	_ = c.conn.SetDeadline(time.Now().Add(d))
+}
+
+func (c *Conn) close(reason string) {
+	if c.client == nil {
+		return
+	}
+
+	// After an error the connection may be broken; QUIT would only wait
+	// for a reply that never comes.
+	if reason == "error" {
+		_ = c.client.Close()
+	} else {
+		c.deadline(quitTimeout)
+		if err := c.client.Quit(); err != nil {
+			_ = c.client.Close()
+		}
+	}
+	c.client = nil
+	c.conn = nil
+	metrics.SMTPConnsOpen.Dec()
+	metrics.SMTPConnCloses.WithLabelValues(reason).Inc()
+}
@@ -0,0 +1,262 @@
+package email
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"PulseSend/internal/models"
+)
+
+func TestConnRedialsDroppedConnection(t *testing.T) {
+	f := newFakeSMTP(t)
+	// The server hangs up after the first message, as on an idle timeout.
+	f.hangup = func(n int) bool { return n == 1 }
+	conn := testSender(t, f).NewConn()
+	defer conn.Close()
+
+	for _, to := range []string{"ann@example.com", "bob@example.com"} {
+		if err := conn.Send(testJob(to)); err != nil {
+			t.Fatalf("send to %s: %v", to, err)
+		}
+	}
+	if dials, messages := f.stats(); dials != 2 || messages != 2 {
+		t.Errorf("dials = %d, messages = %d, want 2 and 2", dials, messages)
+	}
+}
+
+func TestConnDoesNotResendAfterData(t *testing.T) {
+	f := newFakeSMTP(t)
+	// The server takes the second message but drops the connection
+	// before confirming it.
+	f.drop = func(n int) bool { return n == 2 }
+	conn := testSender(t, f).NewConn()
+	defer conn.Close()
+
+	if err := conn.Send(testJob("ann@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	err := conn.Send(testJob("bob@example.com"))
+	if err == nil {
+		t.Fatal("send succeeded although the connection was dropped")
+	}
+	if class := Classify(err); class != models.FailureTransient {
+		t.Errorf("Classify(%v) = %s, want transient", err, class)
+	}
+	if dials, messages := f.stats(); dials != 1 || messages != 2 {
+		t.Errorf("dials = %d, messages = %d, want 1 and 2", dials, messages)
+	}
+}
+
+func TestConnTimesOutStalledServer(t *testing.T) {
+	f := newFakeSMTP(t)
+	f.stall = func(n int) bool { return n == 1 }
+	sender := testSender(t, f)
+	sender.Timeout = 200 * time.Millisecond
+	conn := sender.NewConn()
+	defer conn.Close()
+
+	start := time.Now()
+	err := conn.Send(testJob("ann@example.com"))
+	if err == nil {
+		t.Fatal("send succeeded although the server never replied")
+	}
+	if class := Classify(err); class != models.FailureTransient {
+		t.Errorf("Classify(%v) = %s, want transient", err, class)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("send took %s with a 200ms timeout", elapsed)
+	}
+}
+
+func TestConnSkipsRefusedRecipients(t *testing.T) {
+	f := newFakeSMTP(t)
+	f.rcpt = func(addr string) string {
+		switch {
+		case strings.HasPrefix(addr, "bad"):
+			return "550 5.1.1 user unknown"
+		case strings.HasPrefix(addr, "busy"):
+			return "451 4.2.1 try again later"
+		}
+		return "250 ok"
+	}
+	conn := testSender(t, f).NewConn()
+	defer conn.Close()
+
+	job := testJob("ann@example.com")
+	job.Cc = []string{"bad@example.com"}
+	job.Bcc = []string{"carl@example.com"}
+	attempt, err := conn.Attempt(job)
+	if err != nil {
+		t.Fatalf("send failed over one refused cc: %v", err)
+	}
+	if !attempt.Success || !strings.Contains(attempt.Error, "bad@example.com") {
+		t.Errorf("attempt = %+v, want success recording bad@example.com", attempt)
+	}
+	if got := f.recipients(); fmt.Sprint(got) != "[[ann@example.com carl@example.com]]" {
+		t.Errorf("delivered to %v", got)
+	}
+
+	for _, tc := range []struct {
+		name string
+		cc   []string
+		want models.FailureClass
+	}{
+		{"all refused", []string{"bad2@example.com"}, models.FailurePermanent},
+		{"one refused temporarily", []string{"busy@example.com"}, models.FailureTransient},
+	} {
+		job := testJob("bad@example.com")
+		job.Cc = tc.cc
+		attempt, err := conn.Attempt(job)
+		if err == nil || attempt.Success {
+			t.Fatalf("%s: send succeeded", tc.name)
+		}
+		if class := Classify(err); class != tc.want {
+			t.Errorf("%s: Classify(%v) = %s, want %s", tc.name, err, class, tc.want)
+		}
+	}
+	if got := f.recipients(); len(got) != 1 {
+		t.Errorf("messages after refusals = %d, want 1", len(got))
+	}
+	if dials, _ := f.stats(); dials != 1 {
+		t.Errorf("dials = %d, want 1", dials)
+	}
+}
+
+// fakeSMTP is an SMTP server that accepts every recipient unless rcpt
+// gives another reply. After the nth
+// message it drops the connection without a reply when drop(n) is true,
+// never replies when stall(n) is true and hangs up after replying when
+// hangup(n) is true.
+type fakeSMTP struct {
+	ln     net.Listener
+	drop   func(n int) bool
+	stall  func(n int) bool
+	hangup func(n int) bool
+	rcpt   func(addr string) string
+
+	mu        sync.Mutex
+	dials     int
+	messages  int
+	delivered [][]string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeSMTP{ln: ln}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.dials++
+			f.mu.Unlock()
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) serve(c net.Conn) {
+	defer c.Close()
+	tc := textproto.NewConn(c)
+	tc.PrintfLine("220 fake ESMTP")
+	var accepted []string
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(line); {
+		case strings.HasPrefix(cmd, "MAIL FROM:"), cmd == "RSET":
+			accepted = nil
+			tc.PrintfLine("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			addr := strings.Trim(line[len("RCPT TO:"):], "<> ")
+			reply := "250 ok"
+			if f.rcpt != nil {
+				reply = f.rcpt(addr)
+			}
+			if strings.HasPrefix(reply, "250") {
+				accepted = append(accepted, addr)
+			}
+			tc.PrintfLine("%s", reply)
+		case cmd == "DATA":
+			tc.PrintfLine("354 go ahead")
+			if _, err := tc.ReadDotBytes(); err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.messages++
+			n := f.messages
+			f.delivered = append(f.delivered, accepted)
+			f.mu.Unlock()
+			if f.drop != nil && f.drop(n) {
+				return
+			}
+			if f.stall != nil && f.stall(n) {
+				_, _ = io.Copy(io.Discard, c)
+				return
+			}
+			tc.PrintfLine("250 queued")
+			if f.hangup != nil && f.hangup(n) {
+				return
+			}
+		case cmd == "QUIT":
+			tc.PrintfLine("221 bye")
+			return
+		default:
+			tc.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (f *fakeSMTP) stats() (dials, messages int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dials, f.messages
+}
+
+// recipients returns the accepted recipients of each message received.
+func (f *fakeSMTP) recipients() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]string(nil), f.delivered...)
+}
+
+func testSender(t *testing.T, f *fakeSMTP) *Sender {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "t.html"), []byte("<p>Hello</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Sender{
+		Host:      "127.0.0.1",
+		Port:      f.ln.Addr().(*net.TCPAddr).Port,
+		From:      "noreply@example.com",
+		Templates: templates,
+	}
+}
+
+func testJob(to string) models.EmailJob {
+	return models.EmailJob{To: to, Subject: "Hello", Template: "t.html"}
+}
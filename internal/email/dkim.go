@@ -0,0 +1,299 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/gomail.v2"
+
+	"PulseSend/internal/models"
+)
+
+// dkimHeaders are the header fields signed when present, in order. From
+// is required; the others are signed only if the message has them.
+var dkimHeaders = []string{
+	"from", "sender", "reply-to", "subject", "date", "message-id",
+	"to", "cc", "mime-version", "content-type", "content-transfer-encoding",
+	"in-reply-to", "references", "list-id", "list-unsubscribe", "list-unsubscribe-post",
+}
+
+// DKIMSigner signs messages for one domain (RFC 6376) with relaxed/relaxed
+// canonicalization. RSA keys sign with rsa-sha256, Ed25519 keys with
+// ed25519-sha256 (RFC 8463).
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	Key      crypto.Signer
+}
+
+// DKIMKeys maps sender domains to their signer.
+type DKIMKeys map[string]*DKIMSigner
+
+// LoadDKIMKeys reads a comma-separated list of "domain:selector:keyfile"
+// entries, where keyfile is a PEM encoded PKCS #1 or PKCS #8 private key.
+func LoadDKIMKeys(list string) (DKIMKeys, error) {
+	keys := make(DKIMKeys)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("dkim key %q: want domain:selector:keyfile", entry)
+		}
+		domain := strings.ToLower(parts[0])
+		if _, dup := keys[domain]; dup {
+			return nil, fmt.Errorf("dkim key for %s given twice", domain)
+		}
+
+		data, err := os.ReadFile(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("dkim key for %s: %w", domain, err)
+		}
+		key, err := ParseDKIMKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("dkim key for %s: %w", domain, err)
+		}
+		keys[domain] = &DKIMSigner{Domain: domain, Selector: parts[1], Key: key}
+	}
+	return keys, nil
+}
+
+// ParseDKIMKey parses a PEM encoded RSA or Ed25519 private key.
+func ParseDKIMKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 1024 {
+			return nil, fmt.Errorf("rsa key has %d bits, need at least 1024", k.N.BitLen())
+		}
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// For returns the signer for the domain of addr, or nil if mail from it
+// is sent unsigned.
+func (k DKIMKeys) For(addr string) *DKIMSigner {
+	at := strings.LastIndex(addr, "@")
+	if at < 0 {
+		return nil
+	}
+	return k[strings.ToLower(addr[at+1:])]
+}
+
+// Sign returns msg, a complete message, with a DKIM-Signature header
+// prepended. Line endings are normalised to CRLF first, as they will be on
+// the wire.
+func (s *DKIMSigner) Sign(msg []byte, now time.Time) ([]byte, error) {
+	var alg string
+	switch s.Key.(type) {
+	case *rsa.PrivateKey:
+		alg = "rsa-sha256"
+	case ed25519.PrivateKey:
+		alg = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("dkim: unsupported key type %T", s.Key)
+	}
+
+	msg = toCRLF(msg)
+	fields, body := splitMessage(msg)
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	// Sign the last instance of each header, as verifiers pick them from
+	// the bottom up.
+	var (
+		names  []string
+		signed bytes.Buffer
+	)
+	for _, name := range dkimHeaders {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if fieldName(fields[i]) == name {
+				names = append(names, name)
+				signed.WriteString(relaxedHeader(fields[i]) + "\r\n")
+				break
+			}
+		}
+	}
+	if len(names) == 0 || names[0] != "from" {
+		return nil, errors.New("dkim: message has no From header")
+	}
+
+	header := fmt.Sprintf("DKIM-Signature: v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%d;\r\n"+
+		" h=%s;\r\n bh=%s;\r\n b=",
+		alg, s.Domain, s.Selector, now.Unix(),
+		strings.Join(names, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+	signed.WriteString(relaxedHeader(header))
+
+	digest := sha256.Sum256(signed.Bytes())
+	opts := crypto.Hash(0) // Ed25519 signs the digest itself
+	if alg == "rsa-sha256" {
+		opts = crypto.SHA256
+	}
+	sig, err := s.Key.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		return nil, fmt.Errorf("dkim: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(header)
+	out.WriteString(foldBase64(base64.StdEncoding.EncodeToString(sig)))
+	out.WriteString("\r\n")
+	out.Write(msg)
+	return out.Bytes(), nil
+}
+
+// signed renders m and signs it when a DKIM key is configured for the
+// sending domain.
+func (s *Sender) signed(job models.EmailJob, m *gomail.Message) (io.WriterTo, error) {
+	signer := s.DKIM.For(s.from(job))
+	if signer == nil {
+		return m, nil
+	}
+
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		return nil, err
+	}
+	msg, err := signer.Sign(b.Bytes(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return rawMessage(msg), nil
+}
+
+// rawMessage is a message already rendered to bytes. Unlike a reader it
+// can be written more than once, e.g. again after a redial.
+type rawMessage []byte
+
+func (r rawMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(r)
+	return int64(n), err
+}
+
+// splitMessage splits a CRLF message into its header fields, each with its
+// continuation lines but without the final CRLF, and its body.
+func splitMessage(msg []byte) (fields []string, body []byte) {
+	head := msg
+	if i := bytes.Index(msg, []byte("\r\n\r\n")); i >= 0 {
+		head, body = msg[:i], msg[i+4:]
+	}
+
+	for _, line := range strings.Split(string(head), "\r\n") {
+		if len(fields) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			fields[len(fields)-1] += "\r\n" + line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields, body
+}
+
+func fieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.ToLower(strings.TrimRight(name, " \t"))
+}
+
+// relaxedHeader canonicalizes a header field (RFC 6376 section 3.4.2):
+// lower-case name, unfolded value with whitespace runs reduced to one
+// space, no whitespace around the colon or at the end.
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.Trim(collapseWSP(strings.ReplaceAll(value, "\r\n", "")), " ")
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + value
+}
+
+// relaxedBody canonicalizes a body (RFC 6376 section 3.4.4): whitespace
+// runs reduced to one space, none at line ends, no trailing empty lines.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(collapseWSP(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// collapseWSP replaces each run of spaces and tabs with a single space.
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == ' ' || c == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// toCRLF turns bare LF line endings into CRLF.
+func toCRLF(msg []byte) []byte {
+	if !bytes.Contains(bytes.ReplaceAll(msg, []byte("\r\n"), nil), []byte("\n")) {
+		return msg
+	}
+	msg = bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(msg, []byte("\n"), []byte("\r\n"))
+}
+
+// foldBase64 breaks a long base64 value over continuation lines.
+func foldBase64(s string) string {
+	const width = 72
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width] + "\r\n ")
+		s = s[width:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
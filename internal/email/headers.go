@@ -0,0 +1,138 @@
+package email
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"PulseSend/internal/models"
+)
+
+const (
+	// MaxHeaders bounds the custom headers of one job.
+	MaxHeaders = 20
+	// MaxTags bounds the tags of one job.
+	MaxTags = 20
+
+	// maxHeaderLine is the longest header line RFC 5322 allows, without
+	// the CRLF.
+	maxHeaderLine = 998
+)
+
+// reservedHeaders are set by the sender, or describe the message
+// structure or its delivery, and cannot be given by jobs. Keys are in
+// canonical form.
+var reservedHeaders = map[string]bool{
+	"From":                   true,
+	"Sender":                 true,
+	"To":                     true,
+	"Cc":                     true,
+	"Bcc":                    true,
+	"Reply-To":               true,
+	"Subject":                true,
+	"Date":                   true,
+	"Message-Id":             true,
+	"Mime-Version":           true,
+	"Return-Path":            true,
+	"Received":               true,
+	"Delivered-To":           true,
+	"Dkim-Signature":         true,
+	"Authentication-Results": true,
+}
+
+// reservedPrefixes extend reservedHeaders to whole header families.
+var reservedPrefixes = []string{"Content-", "Resent-", "Arc-"}
+
+// tagPattern keeps tags free of quotes and backslashes, so they can be
+// matched inside their stored JSON, and of anything needing escaping in
+// a URL query.
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/-]{0,63}$`)
+
+// CheckHeaders validates the job's custom headers and rewrites their
+// names in canonical form ("x-campaign-id" becomes "X-Campaign-Id").
+func CheckHeaders(job *models.EmailJob) error {
+	if len(job.Headers) == 0 {
+		job.Headers = nil
+		return nil
+	}
+	if len(job.Headers) > MaxHeaders {
+		return fmt.Errorf("too many headers (%d, max %d)", len(job.Headers), MaxHeaders)
+	}
+
+	headers := make(map[string]string, len(job.Headers))
+	for name, value := range job.Headers {
+		if !validHeaderName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		if reservedHeader(key) {
+			return fmt.Errorf("header %s cannot be set", key)
+		}
+		if _, dup := headers[key]; dup {
+			return fmt.Errorf("duplicate header %s", key)
+		}
+
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("header %s: value must be a single line", key)
+		}
+		value = strings.TrimSpace(value)
+		if len(key)+2+len(value) > maxHeaderLine {
+			return fmt.Errorf("header %s is too long", key)
+		}
+		headers[key] = value
+	}
+	job.Headers = headers
+	return nil
+}
+
+// CheckTags validates the job's tags and drops duplicates.
+func CheckTags(job *models.EmailJob) error {
+	if len(job.Tags) > MaxTags {
+		return fmt.Errorf("too many tags (%d, max %d)", len(job.Tags), MaxTags)
+	}
+
+	tags := make([]string, 0, len(job.Tags))
+	seen := make(map[string]bool, len(job.Tags))
+	for _, tag := range job.Tags {
+		tag = strings.TrimSpace(tag)
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q: use up to 64 letters, digits and _.:/-", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	job.Tags = tags
+	return nil
+}
+
+func reservedHeader(key string) bool {
+	if reservedHeaders[key] {
+		return true
+	}
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validHeaderName reports whether name is an RFC 5322 field name:
+// printable ASCII other than the colon.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c < '!' || c > '~' || c == ':' {
+			return false
+		}
+	}
+	return true
+}
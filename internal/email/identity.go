@@ -0,0 +1,109 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"text/template"
+
+	"PulseSend/internal/models"
+)
+
+// Identities is the allow-list of addresses jobs may send from or ask
+// replies to go to. An entry is either an address ("billing@example.com")
+// or a whole domain ("@support.example.com").
+type Identities struct {
+	addrs   map[string]bool
+	domains map[string]bool
+}
+
+// ParseIdentities parses a comma-separated allow-list. The default sender
+// is always allowed.
+func ParseIdentities(list, defaultFrom string) (*Identities, error) {
+	ids := &Identities{
+		addrs:   make(map[string]bool),
+		domains: make(map[string]bool),
+	}
+
+	for _, entry := range append(strings.Split(list, ","), defaultFrom) {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case strings.HasPrefix(entry, "@") && len(entry) > 1:
+			ids.domains[entry[1:]] = true
+		default:
+			addr, err := mail.ParseAddress(entry)
+			if err != nil {
+				return nil, fmt.Errorf("sender identity %q: %w", entry, err)
+			}
+			ids.addrs[strings.ToLower(addr.Address)] = true
+		}
+	}
+	return ids, nil
+}
+
+// Allowed reports whether addr, a bare address, is on the allow-list.
+func (ids *Identities) Allowed(addr string) bool {
+	addr = strings.ToLower(addr)
+	if ids.addrs[addr] {
+		return true
+	}
+	at := strings.LastIndex(addr, "@")
+	return at >= 0 && ids.domains[addr[at+1:]]
+}
+
+// Check validates the job's From and ReplyTo, normalising them to bare
+// addresses. Empty fields are left alone; the sender's default applies.
+func (ids *Identities) Check(job *models.EmailJob) error {
+	for _, f := range []struct {
+		name string
+		addr *string
+	}{
+		{"from", &job.From},
+		{"reply_to", &job.ReplyTo},
+	} {
+		if strings.TrimSpace(*f.addr) == "" {
+			*f.addr = ""
+			continue
+		}
+
+		addr, err := mail.ParseAddress(*f.addr)
+		if err != nil || addr.Name != "" {
+			return fmt.Errorf("%s must be a plain email address", f.name)
+		}
+		if !ids.Allowed(addr.Address) {
+			return fmt.Errorf("%s %s is not an allowed sender identity", f.name, addr.Address)
+		}
+		*f.addr = addr.Address
+	}
+
+	job.FromName = strings.TrimSpace(job.FromName)
+	return nil
+}
+
+// ParseSubject checks that subject is a valid template.
+func ParseSubject(subject string) error {
+	_, err := template.New("subject").Parse(subject)
+	return err
+}
+
+// renderSubject executes the job's subject as a text/template with the
+// job's data, so subjects can be personalised like bodies.
+func renderSubject(job models.EmailJob) (string, error) {
+	if !strings.Contains(job.Subject, "{{") {
+		return job.Subject, nil
+	}
+
+	tmpl, err := template.New("subject").Parse(job.Subject)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, job.Data); err != nil {
+		return "", err
+	}
+
+	// Data must not be able to inject header lines.
+	return strings.Join(strings.Fields(b.String()), " "), nil
+}
@@ -0,0 +1,133 @@
+package email
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// blankLines matches runs of blank lines left over from nested blocks.
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// HTMLToText turns a rendered HTML body into a readable plain-text version
+// for the text/plain part. Block elements become line breaks, list items
+// are bulleted, links keep their target and images their alt text; scripts,
+// styles and the document head are dropped.
+func HTMLToText(body string) string {
+	var (
+		b    strings.Builder
+		skip int // depth inside elements whose text is not shown
+		href []string
+	)
+
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		tok := z.Token()
+		switch tt {
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			text := strings.Join(strings.Fields(tok.Data), " ")
+			if text == "" {
+				// Whitespace between inline elements still separates words.
+				if tok.Data != "" && !strings.HasSuffix(b.String(), "\n") {
+					writeSpace(&b)
+				}
+				continue
+			}
+			if startsWithSpace(tok.Data) {
+				writeSpace(&b)
+			}
+			b.WriteString(text)
+			if endsWithSpace(tok.Data) {
+				b.WriteByte(' ')
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch tok.Data {
+			case "head", "script", "style", "title":
+				if tt == html.StartTagToken {
+					skip++
+				}
+			case "br":
+				b.WriteString("\n")
+			case "hr":
+				b.WriteString("\n\n----------\n\n")
+			case "li":
+				b.WriteString("\n- ")
+			case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "table", "ul", "ol", "blockquote", "section", "header", "footer":
+				b.WriteString("\n\n")
+			case "tr":
+				b.WriteString("\n")
+			case "td", "th":
+				writeSpace(&b)
+			case "img":
+				if alt := attr(tok, "alt"); alt != "" && skip == 0 {
+					b.WriteString(alt)
+				}
+			case "a":
+				if tt == html.StartTagToken {
+					href = append(href, attr(tok, "href"))
+				}
+			}
+
+		case html.EndTagToken:
+			switch tok.Data {
+			case "head", "script", "style", "title":
+				if skip > 0 {
+					skip--
+				}
+			case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "table", "ul", "ol", "blockquote", "section", "header", "footer":
+				b.WriteString("\n\n")
+			case "a":
+				if len(href) == 0 {
+					continue
+				}
+				link := href[len(href)-1]
+				href = href[:len(href)-1]
+				if link != "" && !strings.HasPrefix(link, "#") && !strings.HasPrefix(link, "mailto:") &&
+					!strings.HasSuffix(strings.TrimSpace(b.String()), link) {
+					b.WriteString(" (" + link + ")")
+				}
+			}
+		}
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text) + "\n"
+}
+
+func attr(tok html.Token, name string) string {
+	for _, a := range tok.Attr {
+		if a.Key == name {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+func writeSpace(b *strings.Builder) {
+	s := b.String()
+	if s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		b.WriteByte(' ')
+	}
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeft(s, " \t\r\n") != s
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.TrimRight(s, " \t\r\n") != s
+}
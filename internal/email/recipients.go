@@ -0,0 +1,108 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"PulseSend/internal/models"
+)
+
+// MaxRecipients bounds to, cc and bcc together, so one job cannot be used
+// as a mailing list.
+const MaxRecipients = 50
+
+// CheckRecipients validates the job's to, cc and bcc addresses and rewrites
+// them in a canonical form: bare addresses, or a quoted display name
+// followed by the address.
+func CheckRecipients(job *models.EmailJob) error {
+	if strings.TrimSpace(job.To) == "" {
+		return errors.New("to is required")
+	}
+
+	to, err := mail.ParseAddressList(job.To)
+	if err != nil {
+		return fmt.Errorf("invalid to: %w", err)
+	}
+
+	cc, err := parseAddresses("cc", job.Cc)
+	if err != nil {
+		return err
+	}
+	bcc, err := parseAddresses("bcc", job.Bcc)
+	if err != nil {
+		return err
+	}
+
+	if n := len(to) + len(cc) + len(bcc); n > MaxRecipients {
+		return fmt.Errorf("too many recipients (%d, max %d)", n, MaxRecipients)
+	}
+
+	job.To = strings.Join(formatAddresses(to), ", ")
+	job.Cc = formatAddresses(cc)
+	job.Bcc = formatAddresses(bcc)
+	return nil
+}
+
+// recipients parses the job's addresses for sending.
+func recipients(job models.EmailJob) (to, cc, bcc []*mail.Address, err error) {
+	if to, err = mail.ParseAddressList(job.To); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid to: %w", err)
+	}
+	if cc, err = parseAddresses("cc", job.Cc); err != nil {
+		return nil, nil, nil, err
+	}
+	if bcc, err = parseAddresses("bcc", job.Bcc); err != nil {
+		return nil, nil, nil, err
+	}
+	return to, cc, bcc, nil
+}
+
+func parseAddresses(field string, list []string) ([]*mail.Address, error) {
+	out := make([]*mail.Address, 0, len(list))
+	for _, s := range list {
+		addr, err := mail.ParseAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s address %q: %w", field, s, err)
+		}
+		out = append(out, addr)
+	}
+	return out, nil
+}
+
+// formatAddresses writes addresses the way they are stored. Unlike
+// mail.Address.String it keeps non-ASCII names readable; the MIME encoding
+// is applied when the message is built.
+func formatAddresses(addrs []*mail.Address) []string {
+	out := make([]string, len(addrs))
+	for i, a := range addrs {
+		if a.Name == "" {
+			out[i] = a.Address
+			continue
+		}
+		name := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(a.Name)
+		out[i] = `"` + name + `" <` + a.Address + `>`
+	}
+	return out
+}
+
+// envelope returns the bare addresses to send to: everyone in to, cc and
+// bcc, each once.
+func envelope(lists ...[]*mail.Address) []string {
+	var (
+		out  []string
+		seen = make(map[string]bool)
+	)
+	for _, list := range lists {
+		for _, a := range list {
+			key := strings.ToLower(a.Address)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, a.Address)
+		}
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package email
+
+import (
+	"errors"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// replyPattern finds an SMTP reply such as `550 5.1.1 user unknown` inside
+// an error message. Conn keeps the server's *textproto.Error intact, but
+// errors that were flattened into text (e.g. by gomail.Send, or read back
+// from the database) have to be parsed.
+var replyPattern = regexp.MustCompile(`\b([2-5][0-9]{2})[ -]"?([^"]*)"?$`)
+
+// ParseReply extracts the SMTP reply code and text from a send error. It
+// returns 0 and "" when err carries no SMTP reply, e.g. for connection or
+// template errors.
+func ParseReply(err error) (int, string) {
+	if err == nil {
+		return 0, ""
+	}
+
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code, tpErr.Msg
+	}
+
+	m := replyPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0, ""
+	}
+	code, _ := strconv.Atoi(m[1])
+	return code, strings.TrimSpace(m[2])
+}
@@ -1,15 +1,15 @@
 package email
 
 import (
+	"PulseSend/internal/attachment"
 	"PulseSend/internal/models"
 	"bytes"
-	"context"
 	"fmt"
-	"html/template"
-	"path/filepath"
+	"io"
+	"mime"
+	"net/mail"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
 	"gopkg.in/gomail.v2"
 )
 
@@ -19,55 +19,160 @@ type Sender struct {
 	From     string
 	Username string
 	Password string
-}
 
-// Send renders the template and sends the email
-func (s *Sender) Send(job models.EmailJob) error {
+	// Templates renders job bodies.
+	Templates *Templates
+	// Attachments holds the files jobs reference.
+	Attachments *attachment.Store
+	// DKIM signs mail from the domains it has keys for; mail from other
+	// domains is sent unsigned.
+	DKIM DKIMKeys
+
+	// IdleTimeout closes a connection that has not sent anything for
+	// this long, before the server drops it on its own. Zero keeps idle
+	// connections open.
+	IdleTimeout time.Duration
+	// MaxMessages is how many messages one connection sends before it
+	// is replaced. Zero means no limit.
+	MaxMessages int
+	// Timeout bounds each exchange with the server: connecting and
+	// logging in, and each message's transaction. Zero means
+	// DefaultTimeout.
+	Timeout time.Duration
+}
 
-	// Build template path safely
-	templatePath := filepath.Join("templates", job.Template)
+// NewConn returns a connection for one worker. It dials on first use and
+// is not safe for concurrent use.
+func (s *Sender) NewConn() *Conn {
+	return &Conn{sender: s}
+}
 
-	tmpl, err := template.ParseFiles(templatePath)
+// message renders the job's template into a ready-to-send message and
+// returns it with the envelope recipients.
+func (s *Sender) message(job models.EmailJob) (*gomail.Message, []string, error) {
+	tmpl, err := s.Templates.Lookup(job.Template)
 	if err != nil {
-		return fmt.Errorf("template parse error: %w", err)
+		return nil, nil, permanent(err)
 	}
 
 	var body bytes.Buffer
 
 	// Execute template with dynamic data
 	if err := tmpl.Execute(&body, job.Data); err != nil {
-		return fmt.Errorf("template execution error: %w", err)
+		return nil, nil, permanent(fmt.Errorf("template execution error: %w", err))
 	}
 
-	m := gomail.NewMessage()
-	m.SetHeader("From", s.From)
-	m.SetHeader("To", job.To)
-	m.SetHeader("Subject", job.Subject)
-	m.SetBody("text/html", body.String())
+	// Plain-text part: the template's .txt companion if it has one,
+	// otherwise derived from the rendered HTML.
+	var text string
+	if txt := s.Templates.LookupText(job.Template); txt != nil {
+		var b bytes.Buffer
+		if err := txt.Execute(&b, job.Data); err != nil {
+			return nil, nil, permanent(fmt.Errorf("text template execution error: %w", err))
+		}
+		text = b.String()
+	} else {
+		text = HTMLToText(body.String())
+	}
 
-	d := gomail.NewDialer(s.Host, s.Port, s.Username, s.Password)
+	subject, err := renderSubject(job)
+	if err != nil {
+		return nil, nil, permanent(fmt.Errorf("subject template error: %w", err))
+	}
 
-	if err := d.DialAndSend(m); err != nil {
-		return fmt.Errorf("smtp send error: %w", err)
+	to, cc, bcc, err := recipients(job)
+	if err != nil {
+		return nil, nil, permanent(err)
+	}
+
+	// Headers were checked on insert; checking again keeps a stored job
+	// from overriding the sender's headers whatever its origin.
+	if err := CheckHeaders(&job); err != nil {
+		return nil, nil, permanent(err)
+	}
+
+	m := gomail.NewMessage()
+	if job.FromName != "" {
+		m.SetAddressHeader("From", s.from(job), job.FromName)
+	} else {
+		m.SetHeader("From", s.from(job))
+	}
+	if job.ReplyTo != "" {
+		m.SetHeader("Reply-To", job.ReplyTo)
+	}
+	m.SetHeader("To", headerAddresses(m, to)...)
+	if len(cc) > 0 {
+		m.SetHeader("Cc", headerAddresses(m, cc)...)
+	}
+	m.SetHeader("Subject", subject)
+	for name, value := range job.Headers {
+		m.SetHeader(name, value)
+	}
+	m.SetBody("text/plain", text)
+	html, err := s.embedAssets(m, body.String())
+	if err != nil {
+		return nil, nil, permanent(err)
+	}
+	m.AddAlternative("text/html", html)
+
+	for _, a := range job.Attachments {
+		content, err := s.Attachments.Read(a)
+		if err != nil {
+			return nil, nil, permanent(fmt.Errorf("attachment %s: %w", a.Filename, err))
+		}
+
+		m.Attach(a.Filename,
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(content)
+				return err
+			}),
+			gomail.SetHeader(map[string][]string{
+				"Content-Type":        {mime.FormatMediaType(a.ContentType, map[string]string{"name": a.Filename})},
+				"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			}),
+		)
 	}
 
-	return nil
+	return m, envelope(to, cc, bcc), nil
 }
 
-// SendWithRetry retries email sending with exponential backoff
-func (s *Sender) SendWithRetry(
-	ctx context.Context,
-	job models.EmailJob,
-	retries int,
-) error {
+// from is the address the job is sent from: its own, which the API checked
+// against the sender identities, or the default.
+func (s *Sender) from(job models.EmailJob) string {
+	if job.From != "" {
+		return job.From
+	}
+	return s.From
+}
+
+// attempt describes a finished send.
+func (s *Sender) attempt(job models.EmailJob, started time.Time, err error) models.EmailAttempt {
+	a := models.EmailAttempt{
+		JobID:      job.ID,
+		SMTPHost:   fmt.Sprintf("%s:%d", s.Host, s.Port),
+		StartedAt:  started,
+		FinishedAt: time.Now().UTC(),
+		Success:    err == nil,
+	}
 
-	operation := func() error {
-		return s.Send(job)
+	if err != nil {
+		a.Error = err.Error()
+		a.ResponseCode, a.ResponseText = ParseReply(err)
+	} else {
+		// net/smtp only returns from DATA once the server accepted the
+		// message with 250; the reply text itself is not exposed.
+		a.ResponseCode = 250
 	}
 
-	b := backoff.NewExponentialBackOff()
-	b.InitialInterval = 500 * time.Millisecond
-	b.MaxElapsedTime = time.Duration(retries) * time.Second
+	return a
+}
 
-	return backoff.Retry(operation, backoff.WithContext(b, ctx))
+// headerAddresses formats addresses for an address header, encoding
+// display names as needed.
+func headerAddresses(m *gomail.Message, addrs []*mail.Address) []string {
+	out := make([]string, len(addrs))
+	for i, a := range addrs {
+		out[i] = m.FormatAddress(a.Address, a.Name)
+	}
+	return out
 }
@@ -0,0 +1,191 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"PulseSend/internal/models"
+)
+
+const (
+	// dialTimeout bounds connecting to the SMTP server.
+	dialTimeout = 10 * time.Second
+	// DefaultTimeout bounds each SMTP exchange when Sender.Timeout is zero.
+	DefaultTimeout = time.Minute
+	// quitTimeout bounds saying goodbye to a server that may be gone.
+	quitTimeout = 5 * time.Second
+)
+
+// dial opens an authenticated SMTP session the way gomail's Dialer does:
+// implicit TLS on port 465, otherwise STARTTLS when the server offers it,
+// then AUTH when a username is set. gomail's SendCloser cannot RSET, so
+// Conn drives the session itself. The returned net.Conn is the one under
+// the client, for setting deadlines.
+func (s *Sender) dial() (*smtp.Client, net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.Host, strconv.Itoa(s.Port)), dialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(s.timeout()))
+
+	ok := false
+	defer func() {
+		if !ok {
+			conn.Close()
+		}
+	}()
+
+	tlsConfig := &tls.Config{ServerName: s.Host}
+	ssl := s.Port == 465
+	if ssl {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !ssl {
+		if has, _ := c.Extension("STARTTLS"); has {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if s.Username != "" {
+		if has, mechs := c.Extension("AUTH"); has {
+			if err := c.Auth(s.auth(mechs)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	ok = true
+	return c, conn, nil
+}
+
+func (s *Sender) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+// auth picks a mechanism the server advertises, preferring CRAM-MD5 and
+// using LOGIN only when PLAIN is not offered.
+func (s *Sender) auth(mechs string) smtp.Auth {
+	switch {
+	case strings.Contains(mechs, "CRAM-MD5"):
+		return smtp.CRAMMD5Auth(s.Username, s.Password)
+	case strings.Contains(mechs, "LOGIN") && !strings.Contains(mechs, "PLAIN"):
+		return &loginAuth{username: s.Username, password: s.Password, host: s.Host}
+	default:
+		return smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+}
+
+// deliver completes the mail transaction begun with MAIL FROM. Recipients
+// the server refuses are skipped and returned as refused, so one bad cc
+// does not keep the message from the others; only when every recipient
+// is refused is that the error. The session is left mid-transaction on
+// error; the caller resets or closes it.
+func deliver(c *smtp.Client, to []string, msg io.WriterTo) (refused, err error) {
+	var rejected rcptError
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			var reply *textproto.Error
+			if !errors.As(err, &reply) || reply.Code == 421 {
+				return nil, err
+			}
+			rejected.refused = append(rejected.refused, refusal{addr: addr, reply: reply})
+		}
+	}
+	if len(rejected.refused) == len(to) {
+		return nil, &rejected
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := msg.WriteTo(w); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(rejected.refused) > 0 {
+		return &rejected, nil
+	}
+	return nil, nil
+}
+
+// rcptError lists the recipients the server refused at RCPT.
+type rcptError struct {
+	refused []refusal
+}
+
+type refusal struct {
+	addr  string
+	reply *textproto.Error
+}
+
+func (e *rcptError) Error() string {
+	parts := make([]string, len(e.refused))
+	for i, r := range e.refused {
+		parts[i] = r.addr + ": " + r.reply.Error()
+	}
+	return "recipients refused: " + strings.Join(parts, "; ")
+}
+
+// Unwrap returns the reply the error is classified by: a temporary
+// refusal if there is one, as a retry may then get through.
+func (e *rcptError) Unwrap() error {
+	for _, r := range e.refused {
+		if Classify(r.reply) == models.FailureTransient {
+			return r.reply
+		}
+	}
+	return e.refused[0].reply
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp lacks. Like
+// PlainAuth it refuses to send credentials over an unencrypted connection
+// to another host.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && a.host != "localhost" && a.host != "127.0.0.1" && a.host != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, errors.New("unexpected server challenge: " + string(fromServer))
+	}
+}
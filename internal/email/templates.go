@@ -0,0 +1,238 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// assetsDir is the subdirectory holding files templates embed, such as
+// logos. Its contents are loaded as assets, never parsed as templates.
+const assetsDir = "assets"
+
+// Templates holds the compiled templates of a directory, keyed by their
+// slash-separated path relative to it (e.g. "email.html"). An HTML
+// template may have a plain-text companion next to it ("email.txt").
+// Templates are parsed once and shared by all workers; Reload swaps in a
+// new set only if every template in it parses.
+type Templates struct {
+	dir string
+
+	mu      sync.RWMutex
+	set     map[string]*template.Template
+	texts   map[string]*texttemplate.Template
+	assets  map[string][]byte
+	version string
+}
+
+// LoadTemplates parses every *.html and *.txt file below dir. It fails if any of
+// them does not parse, so a broken template stops startup instead of
+// failing jobs.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{dir: dir}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Lookup returns the compiled template called name.
+func (t *Templates) Lookup(name string) (*template.Template, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	tmpl, ok := t.set[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("template %q not found", name)
+	}
+	return tmpl, nil
+}
+
+// LookupText returns the plain-text companion of the HTML template called
+// name, or nil if there is none.
+func (t *Templates) LookupText(name string) *texttemplate.Template {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	name = strings.TrimSuffix(path.Clean(name), path.Ext(name)) + ".txt"
+	return t.texts[name]
+}
+
+// Asset returns the contents of the file called name in the assets
+// directory, e.g. "logo.png" for templates/assets/logo.png.
+func (t *Templates) Asset(name string) ([]byte, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	data, ok := t.assets[path.Clean(name)]
+	return data, ok
+}
+
+// Len returns the number of loaded templates.
+func (t *Templates) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.set) + len(t.texts)
+}
+
+// Reload parses the directory again. On error the current templates stay
+// in use.
+func (t *Templates) Reload() error {
+	version, err := t.scan()
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]*template.Template)
+	texts := make(map[string]*texttemplate.Template)
+	assets := make(map[string][]byte)
+	err = filepath.WalkDir(t.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name, err := t.name(p)
+		if err != nil {
+			return err
+		}
+
+		if asset, ok := strings.CutPrefix(name, assetsDir+"/"); ok {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			assets[asset] = data
+			return nil
+		}
+		if !isTemplate(p) {
+			return nil
+		}
+
+		if path.Ext(name) == ".txt" {
+			tmpl, err := texttemplate.ParseFiles(p)
+			if err != nil {
+				return fmt.Errorf("template %s: %w", name, err)
+			}
+			texts[name] = tmpl
+			return nil
+		}
+
+		tmpl, err := template.ParseFiles(p)
+		if err != nil {
+			return fmt.Errorf("template %s: %w", name, err)
+		}
+		set[name] = tmpl
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.set = set
+	t.texts = texts
+	t.assets = assets
+	t.version = version
+	t.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the templates whenever a file in the directory is added,
+// removed or modified, checking every interval until ctx is done. Failed
+// reloads are logged and the previous templates kept.
+func (t *Templates) Watch(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// failed is the last version that did not parse, so a broken file is
+	// reported once rather than on every tick.
+	var failed string
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		version, err := t.scan()
+		if err != nil {
+			log.Warn("failed to scan templates", zap.Error(err))
+			continue
+		}
+
+		t.mu.RLock()
+		changed := version != t.version
+		t.mu.RUnlock()
+		if !changed || version == failed {
+			continue
+		}
+
+		if err := t.Reload(); err != nil {
+			failed = version
+			log.Error("template reload failed, keeping previous templates", zap.Error(err))
+			continue
+		}
+		log.Info("templates reloaded", zap.Int("templates", t.Len()))
+	}
+}
+
+// scan fingerprints the directory by the name, size and modification time
+// of its templates and assets, which is enough to notice edits without
+// parsing.
+func (t *Templates) scan() (string, error) {
+	var b strings.Builder
+	err := filepath.WalkDir(t.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name, err := t.name(p)
+		if err != nil {
+			return err
+		}
+		if !isTemplate(p) && !strings.HasPrefix(name, assetsDir+"/") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", p, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (t *Templates) name(p string) (string, error) {
+	rel, err := filepath.Rel(t.dir, p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func isTemplate(p string) bool {
+	ext := filepath.Ext(p)
+	return ext == ".html" || ext == ".txt"
+}
@@ -18,9 +18,66 @@ var (
 			Help: "Total failed emails",
 		},
 	)
+
+	EmailRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "email_retries_scheduled_total",
+			Help: "Total failed attempts scheduled for another try",
+		},
+	)
+
+	SMTPConnsOpen = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "smtp_connections_open",
+			Help: "SMTP connections currently held open by workers",
+		},
+	)
+
+	SMTPDials = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "smtp_dials_total",
+			Help: "Total SMTP connection attempts",
+		},
+	)
+
+	SMTPDialErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "smtp_dial_errors_total",
+			Help: "Total SMTP connection attempts that failed",
+		},
+	)
+
+	SMTPConnReuses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "smtp_connection_reuses_total",
+			Help: "Total emails sent over an already open connection",
+		},
+	)
+
+	SMTPConnResets = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "smtp_connection_resets_total",
+			Help: "Total rejected messages after which the connection was kept with RSET",
+		},
+	)
+
+	SMTPConnCloses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "smtp_connection_closes_total",
+			Help: "Total SMTP connections closed, by reason (error, idle, max_messages, shutdown)",
+		},
+		[]string{"reason"},
+	)
 )
 
 func Init() {
 	prometheus.MustRegister(EmailsSent)
 	prometheus.MustRegister(EmailFailures)
+	prometheus.MustRegister(EmailRetries)
+	prometheus.MustRegister(SMTPConnsOpen)
+	prometheus.MustRegister(SMTPDials)
+	prometheus.MustRegister(SMTPDialErrors)
+	prometheus.MustRegister(SMTPConnReuses)
+	prometheus.MustRegister(SMTPConnResets)
+	prometheus.MustRegister(SMTPConnCloses)
 }
@@ -0,0 +1,14 @@
+package models
+
+// Attachment is a file sent with an EmailJob. The contents live in the
+// attachment store under SHA256; jobs only keep this reference.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+
+	// Content carries the file on the way in (base64 in JSON). It is
+	// moved to the attachment store and never stored on the job.
+	Content []byte `json:"content,omitempty"`
+}
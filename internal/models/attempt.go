@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// EmailAttempt records a single delivery attempt of an EmailJob.
+type EmailAttempt struct {
+	ID       int64  `json:"id"`
+	JobID    int64  `json:"job_id"`
+	Attempt  int    `json:"attempt"`
+	WorkerID string `json:"worker_id"`
+	SMTPHost string `json:"smtp_host"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	Success bool `json:"success"`
+	// ResponseCode and ResponseText hold the SMTP reply that ended the
+	// attempt, when there was one.
+	ResponseCode int    `json:"response_code,omitempty"`
+	ResponseText string `json:"response_text,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
@@ -1,27 +1,179 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
 
 type EmailStatus string
 
 const (
+	StatusScheduled  EmailStatus = "scheduled"
 	StatusPending    EmailStatus = "pending"
 	StatusProcessing EmailStatus = "processing"
 	StatusSent       EmailStatus = "sent"
 	StatusFailed     EmailStatus = "failed"
+	StatusCancelled  EmailStatus = "cancelled"
+)
+
+// Valid reports whether s is a known status.
+func (s EmailStatus) Valid() bool {
+	switch s {
+	case StatusScheduled, StatusPending, StatusProcessing, StatusSent, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// FailureClass tells whether a failed send is worth retrying.
+type FailureClass string
+
+const (
+	// FailureTransient covers connection problems and 4xx replies; the
+	// same message may well be accepted later.
+	FailureTransient FailureClass = "transient"
+	// FailurePermanent covers 5xx replies and template errors; retrying
+	// the same message cannot succeed.
+	FailurePermanent FailureClass = "permanent"
+)
+
+// Priority orders pending jobs: higher values are sent first. Zero means
+// "not set" and is replaced by the endpoint's default on insert.
+type Priority int
+
+const (
+	PriorityLow    Priority = 1 // bulk and marketing mail
+	PriorityNormal Priority = 2
+	PriorityHigh   Priority = 3 // transactional mail, e.g. password resets
 )
 
+// Valid reports whether p is a known priority.
+func (p Priority) Valid() bool {
+	return p >= PriorityLow && p <= PriorityHigh
+}
+
 type EmailJob struct {
-	ID       int64                  `json:"id"`
-	To       string                 `json:"to"`
+	ID int64 `json:"id"`
+	// To holds one or more recipients as an address list, e.g.
+	// "Ann Lee <ann@example.com>, bob@example.com".
+	To string `json:"to"`
+	// Each Cc and Bcc entry is a single address. Bcc recipients get the
+	// email but appear in no header.
+	Cc  []string `json:"cc,omitempty"`
+	Bcc []string `json:"bcc,omitempty"`
+
 	Subject  string                 `json:"subject"`
 	Template string                 `json:"template"`
 	Data     map[string]interface{} `json:"data"`
 
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	Priority Priority `json:"priority,omitempty"`
+
+	// From, FromName and ReplyTo override the default sender. From and
+	// ReplyTo must be configured sender identities.
+	From     string `json:"from,omitempty"`
+	FromName string `json:"from_name,omitempty"`
+	ReplyTo  string `json:"reply_to,omitempty"`
+
+	// Headers are added to the message as is, e.g. "X-Campaign-ID" or
+	// "List-Id". Headers the sender sets itself cannot be overridden.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Tags label the job for filtering; they are not sent.
+	Tags []string `json:"tags,omitempty"`
+
+	// SendAt delays the send until the given time. Jobs with a future
+	// SendAt are stored as "scheduled" and released by the scheduler.
+	SendAt *time.Time `json:"send_at,omitempty"`
+
+	// IdempotencyKey makes inserts safe to retry: a second job with the
+	// same key is not stored and the original is returned instead.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
 	Status   EmailStatus `json:"status"`
 	Retries  int         `json:"retries"`
 	ErrorMsg string      `json:"error_msg,omitempty"`
 
+	// FailureClass classifies ErrorMsg once an attempt has failed.
+	FailureClass FailureClass `json:"failure_class,omitempty"`
+
+	// NextRetryAt is set while a job waits to be attempted again after a
+	// failed send; it is not claimed before then.
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// Recipients returns the bare address of everyone the job goes to, in to,
+// cc and bcc, lowercased and each once. This is what the "to" filter of a
+// job search matches.
+func (j EmailJob) Recipients() []string {
+	var (
+		out  []string
+		seen = make(map[string]bool)
+	)
+	add := func(addr string) {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			out = append(out, addr)
+		}
+	}
+
+	if list, err := mail.ParseAddressList(j.To); err == nil {
+		for _, a := range list {
+			add(strings.ToLower(a.Address))
+		}
+	} else {
+		for _, s := range strings.Split(j.To, ",") {
+			add(BareAddress(s))
+		}
+	}
+	for _, list := range [][]string{j.Cc, j.Bcc} {
+		for _, s := range list {
+			add(BareAddress(s))
+		}
+	}
+	return out
+}
+
+// BareAddress returns the lowercased address of s, which may carry a
+// display name, e.g. "Ann Lee <Ann@Example.com>" gives "ann@example.com".
+// Input that does not parse is only trimmed and lowercased.
+func BareAddress(s string) string {
+	if a, err := mail.ParseAddress(s); err == nil {
+		return strings.ToLower(a.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// UnmarshalJSON accepts "to" as a single address list or as an array of
+// addresses, which is joined into one list.
+func (j *EmailJob) UnmarshalJSON(b []byte) error {
+	type plain EmailJob
+	aux := struct {
+		*plain
+		To json.RawMessage `json:"to"`
+	}{plain: (*plain)(j)}
+
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	if len(aux.To) == 0 || string(aux.To) == "null" {
+		return nil
+	}
+
+	if err := json.Unmarshal(aux.To, &j.To); err == nil {
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(aux.To, &list); err != nil {
+		return errors.New("to must be a string or an array of strings")
+	}
+	j.To = strings.Join(list, ", ")
+	return nil
+}
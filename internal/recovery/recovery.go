@@ -0,0 +1,34 @@
+package recovery
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"PulseSend/internal/db"
+)
+
+// Recover prepares email_jobs for a fresh run of the instance identified by
+// owner. Jobs this instance left in "processing" after a crash or deploy
+// are reset to "pending" and its stale leases are dropped, so the
+// dispatcher picks that work up again immediately. Expired leases of any
+// owner are reclaimed too, which covers a previous run under another
+// instance ID. Live leases of other instances are left alone.
+//
+// It must run before the dispatcher starts.
+func Recover(ctx context.Context, store db.Store, owner string, logger *zap.Logger) error {
+	reset, err := store.ResetStale(ctx, owner)
+	if err != nil {
+		return err
+	}
+	reclaimed, err := store.ReclaimExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("recovered unfinished jobs",
+		zap.Int64("reset", reset),
+		zap.Int64("reclaimed", reclaimed),
+	)
+	return nil
+}
@@ -0,0 +1,48 @@
+package retry
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy decides whether and when a failed job is attempted again. Retries
+// are persisted on the job (next_retry_at), not slept on inside a worker,
+// so they survive restarts and never tie up a worker.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// Base is the delay before the first retry; each further retry
+	// doubles it.
+	Base time.Duration
+	// Cap bounds the delay between two attempts.
+	Cap time.Duration
+	// Jitter randomises each delay by up to ±Jitter (0.2 = ±20%), so jobs
+	// that failed together do not retry in lockstep.
+	Jitter float64
+}
+
+// ShouldRetry reports whether a job that has now failed attempts times may
+// be attempted again.
+func (p Policy) ShouldRetry(attempts int) bool {
+	return attempts < p.MaxAttempts
+}
+
+// Delay returns how long to wait after the given failed attempt (1-based)
+// before trying again.
+func (p Policy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	d := float64(p.Base) * math.Pow(2, float64(attempt-1))
+	if p.Cap > 0 && d > float64(p.Cap) {
+		d = float64(p.Cap)
+	}
+
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+
+	return time.Duration(d)
+}
@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"PulseSend/internal/db"
+)
+
+// Scheduler periodically releases scheduled jobs whose send_at has passed,
+// turning them into ordinary pending jobs for the dispatcher. Releasing is
+// a single idempotent UPDATE, so every replica can run its own scheduler.
+type Scheduler struct {
+	Store    db.Store
+	Log      *zap.Logger
+	Interval time.Duration
+
+	// OnRelease, if set, is called after jobs were released, typically
+	// to wake the dispatcher.
+	OnRelease func()
+}
+
+// Run releases due jobs every Interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.Log.Info("scheduler started", zap.Duration("interval", s.Interval))
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.release(ctx)
+
+		select {
+		case <-ctx.Done():
+			s.Log.Info("scheduler shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) release(ctx context.Context) {
+	n, err := s.Store.ReleaseDue(ctx, time.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			s.Log.Error("failed to release scheduled jobs", zap.Error(err))
+		}
+		return
+	}
+	if n == 0 {
+		return
+	}
+
+	s.Log.Info("released scheduled jobs", zap.Int64("count", n))
+	if s.OnRelease != nil {
+		s.OnRelease()
+	}
+}
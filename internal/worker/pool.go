@@ -2,7 +2,10 @@ package worker
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
@@ -11,8 +14,12 @@ import (
 	"PulseSend/internal/email"
 	"PulseSend/internal/metrics"
 	"PulseSend/internal/models"
+	"PulseSend/internal/retry"
 )
 
+// resultTimeout bounds the writes that record the outcome of a send.
+const resultTimeout = 10 * time.Second
+
 func StartPool(
 	ctx context.Context,
 	wg *sync.WaitGroup,
@@ -20,9 +27,11 @@ func StartPool(
 	jobs <-chan models.EmailJob,
 	sender *email.Sender,
 	limiter *rate.Limiter,
-	store *db.Store,
+	store db.Store,
 	logger *zap.Logger,
-	retries int,
+	policy retry.Policy,
+	owner string,
+	lease time.Duration,
 ) {
 
 	for i := 0; i < workers; i++ {
@@ -31,7 +40,23 @@ func StartPool(
 		go func(id int) {
 			defer wg.Done()
 
-			logger.Info("worker started", zap.Int("worker_id", id))
+			workerID := fmt.Sprintf("%s/%d", owner, id)
+
+			// Each worker keeps its own SMTP connection open between jobs.
+			conn := sender.NewConn()
+			defer conn.Close()
+
+			var idle <-chan time.Time
+			if sender.IdleTimeout > 0 {
+				ticker := time.NewTicker(sender.IdleTimeout / 2)
+				defer ticker.Stop()
+				idle = ticker.C
+			}
+
+			logger.Info("worker started",
+				zap.String("instance", owner),
+				zap.Int("worker_id", id),
+			)
 
 			for {
 				select {
@@ -40,6 +65,9 @@ func StartPool(
 					logger.Info("worker shutting down", zap.Int("worker_id", id))
 					return
 
+				case <-idle:
+					conn.CloseIdle()
+
 				case job, ok := <-jobs:
 					if !ok {
 						logger.Info("job channel closed", zap.Int("worker_id", id))
@@ -60,7 +88,14 @@ func StartPool(
 					// ----------------------------
 					// Mark as Processing
 					// ----------------------------
-					if err := store.UpdateStatus(ctx, job.ID, models.StatusProcessing); err != nil {
+					if err := store.StartJob(ctx, job.ID, owner, lease); err != nil {
+						if errors.Is(err, db.ErrNotClaimed) {
+							logger.Info("job taken elsewhere, edited or cancelled, skipping",
+								zap.Int("worker_id", id),
+								zap.Int64("job_id", job.ID),
+							)
+							continue
+						}
 						logger.Error("failed to update status to processing",
 							zap.Int64("job_id", job.ID),
 							zap.Error(err),
@@ -71,16 +106,59 @@ func StartPool(
 					// ----------------------------
 					// Send Email
 					// ----------------------------
-					err := sender.SendWithRetry(ctx, job, retries)
+					attempt, err := conn.Attempt(job)
+					attempt.WorkerID = workerID
+
+					// The email may have been delivered, so its outcome is
+					// written even once shutdown has begun. Otherwise the job
+					// would be reclaimed after a restart and sent again.
+					rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resultTimeout)
+
+					if dbErr := store.RecordAttempt(rctx, &attempt); dbErr != nil {
+						logger.Error("failed to record attempt",
+							zap.Int64("job_id", job.ID),
+							zap.Error(dbErr),
+						)
+					}
 					if err != nil {
+						attempts := job.Retries + 1
+						class := email.Classify(err)
+
+						// ----------------------------
+						// Schedule Retry
+						// ----------------------------
+						if class == models.FailureTransient && policy.ShouldRetry(attempts) {
+							delay := policy.Delay(attempts)
+
+							logger.Warn("email send failed, retry scheduled",
+								zap.Int("worker_id", id),
+								zap.String("to", job.To),
+								zap.Int("attempt", attempts),
+								zap.Duration("retry_in", delay),
+								zap.Error(err),
+							)
+
+							if dbErr := store.ScheduleRetry(rctx, job.ID, err.Error(), time.Now().Add(delay)); dbErr != nil {
+								logger.Error("failed to schedule retry",
+									zap.Int64("job_id", job.ID),
+									zap.Error(dbErr),
+								)
+							}
+
+							metrics.EmailRetries.Inc()
+							cancel()
+							continue
+						}
 
 						logger.Error("email send failed",
 							zap.Int("worker_id", id),
 							zap.String("to", job.To),
+							zap.Int("attempt", attempts),
+							zap.String("failure_class", string(class)),
 							zap.Error(err),
 						)
 
-						if dbErr := store.UpdateFailure(ctx, job.ID, err.Error()); dbErr != nil {
+						if dbErr := store.UpdateFailure(rctx, job.ID, err.Error(), class); dbErr != nil {
 							logger.Error("failed to update failure status",
 								zap.Int64("job_id", job.ID),
 								zap.Error(dbErr),
@@ -88,23 +166,32 @@ func StartPool(
 						}
 
 						metrics.EmailFailures.Inc()
+						cancel()
 						continue
 					}
 
 					// ----------------------------
 					// Mark as Sent
 					// ----------------------------
-					if err := store.UpdateStatus(ctx, job.ID, models.StatusSent); err != nil {
+					if err := store.UpdateStatus(rctx, job.ID, models.StatusSent); err != nil {
 						logger.Error("failed to update sent status",
 							zap.Int64("job_id", job.ID),
 							zap.Error(err),
 						)
 					}
+					cancel()
 
 					logger.Info("email sent successfully",
 						zap.Int("worker_id", id),
 						zap.String("to", job.To),
 					)
+					if attempt.Error != "" {
+						logger.Warn("some recipients were refused",
+							zap.Int("worker_id", id),
+							zap.Int64("job_id", job.ID),
+							zap.String("error", attempt.Error),
+						)
+					}
 
 					metrics.EmailsSent.Inc()
 				}